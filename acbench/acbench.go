@@ -0,0 +1,84 @@
+// Package acbench provides helpers to benchmark ahocorasick searchers over
+// custom dictionaries and texts.
+package acbench
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	ac "github.com/codefever/ahocorasick"
+)
+
+// Stats is the result of Profile.
+type Stats struct {
+	BuildTime  time.Duration
+	BuildMem   int64 // heap growth caused by the build
+	SearchTime time.Duration
+	Matches    int
+}
+
+// LoadDict reads a dictionary file with one word per line, skipping blank
+// lines and trimming spaces.
+func LoadDict(path string) ([]string, error) {
+	fp, err := os.OpenFile(path, os.O_RDONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	ret := make([]string, 0)
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) > 0 {
+			ret = append(ret, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// LoadText reads the whole text file.
+func LoadText(path string) (string, error) {
+	fp, err := os.OpenFile(path, os.O_RDONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+
+	bytes, err := ioutil.ReadAll(fp)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+// HeapAlloc returns the bytes of allocated heap objects after a GC.
+func HeapAlloc() uint64 {
+	mem := new(runtime.MemStats)
+	runtime.GC()
+	runtime.ReadMemStats(mem)
+	return mem.HeapAlloc
+}
+
+// Profile builds a searcher from `builder` and covers `text` with it,
+// measuring the time and heap spent.
+func Profile(builder *ac.Builder, text string) Stats {
+	var stats Stats
+	memBefore := HeapAlloc()
+	timeBefore := time.Now()
+	searcher := builder.Build()
+	stats.BuildTime = time.Since(timeBefore)
+	stats.BuildMem = int64(HeapAlloc()) - int64(memBefore)
+
+	timeBefore = time.Now()
+	stats.Matches = len(searcher.Cover(text))
+	stats.SearchTime = time.Since(timeBefore)
+	return stats
+}
@@ -0,0 +1,42 @@
+package acbench
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ac "github.com/codefever/ahocorasick"
+)
+
+func TestLoadDict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acbench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dict.txt")
+	if err := ioutil.WriteFile(path, []byte("hello\n\n  world \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dict, err := LoadDict(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dict) != 2 || dict[0] != "hello" || dict[1] != "world" {
+		t.Fatal("Unexpected dictionary:", dict)
+	}
+
+	builder := ac.NewBuilder()
+	for i, w := range dict {
+		builder.Add(w, i)
+	}
+	if stats := Profile(builder, "hello world"); stats.Matches != 2 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	if _, err := LoadDict(filepath.Join(dir, "missing.txt")); err == nil {
+		t.Error("Expect an error for missing file")
+	}
+}
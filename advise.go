@@ -0,0 +1,15 @@
+package ahocorasick
+
+// AdviseHint tells Advise the expected access pattern of the arrays.
+type AdviseHint int
+
+const (
+	// AdviseNormal resets to the default access pattern.
+	AdviseNormal AdviseHint = iota
+	// AdviseRandom expects scattered accesses, as on most scans.
+	AdviseRandom
+	// AdviseSequential expects ordered accesses, e.g. while serializing.
+	AdviseSequential
+	// AdviseWillNeed asks to bring the pages in ahead of the accesses.
+	AdviseWillNeed
+)
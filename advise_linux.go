@@ -0,0 +1,44 @@
+//go:build linux
+
+package ahocorasick
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+var adviceFlags = map[AdviseHint]uintptr{
+	AdviseNormal:     syscall.MADV_NORMAL,
+	AdviseRandom:     syscall.MADV_RANDOM,
+	AdviseSequential: syscall.MADV_SEQUENTIAL,
+	AdviseWillNeed:   syscall.MADV_WILLNEED,
+}
+
+// Advise passes `hint` to the kernel by madvise(2) for the pages holding the
+// automaton arrays. The hints are advisory only, so they never change the
+// results of a search. It's a no-op on other systems.
+func (s *Searcher) Advise(hint AdviseHint) error {
+	advice, ok := adviceFlags[hint]
+	if !ok {
+		return fmt.Errorf("ahocorasick: unknown advise hint %d", hint)
+	}
+	pageSize := uintptr(os.Getpagesize())
+	for _, array := range [][]int{s.base, s.check, s.suffixLink} {
+		if len(array) == 0 {
+			continue
+		}
+		start := uintptr(unsafe.Pointer(&array[0]))
+		end := start + uintptr(len(array)*(strconv.IntSize/8))
+		start &^= pageSize - 1
+		_, _, errno := syscall.Syscall(syscall.SYS_MADVISE, start, end-start, advice)
+		runtime.KeepAlive(array)
+		if errno != 0 {
+			return fmt.Errorf("ahocorasick: madvise: %w", errno)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+//go:build linux
+
+package ahocorasick
+
+import (
+	"testing"
+)
+
+func TestAdvise(t *testing.T) {
+	builder := NewBuilder()
+	words := lowercaseDictionary(1000)
+	for _, word := range words {
+		builder.AddWord(word)
+	}
+	searcher := builder.Build()
+	for _, hint := range []AdviseHint{AdviseWillNeed, AdviseSequential, AdviseRandom, AdviseNormal} {
+		if err := searcher.Advise(hint); err != nil {
+			t.Errorf("Unexpected error for hint %v: %v", hint, err)
+		}
+	}
+	if err := searcher.Advise(AdviseHint(-1)); err == nil {
+		t.Error("Expect an error for an unknown hint")
+	}
+	if !searcher.Contains(words[0]) {
+		t.Error("Fail to find the first word after advising")
+	}
+}
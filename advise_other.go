@@ -0,0 +1,8 @@
+//go:build !linux
+
+package ahocorasick
+
+// Advise is a no-op on systems other than Linux.
+func (s *Searcher) Advise(hint AdviseHint) error {
+	return nil
+}
@@ -1,26 +1,104 @@
 package ahocorasick
 
 import (
-	"log"
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"reflect"
+	"runtime"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 const blockSize = 256
 
+// ErrSubstringWords is returned by BuildE with RejectSubstrings when some
+// words are substrings of others.
+var ErrSubstringWords = errors.New("ahocorasick: words are substrings of others")
+
+// ErrInvalidUTF8 is returned by BuildE with RequireValidUTF8 when some words
+// are not valid UTF-8.
+var ErrInvalidUTF8 = errors.New("ahocorasick: words are not valid UTF-8")
+
+// ErrSizeBudgetExceeded is returned by BuildE when the arrays would grow
+// beyond the length set by MaxArrayLen.
+var ErrSizeBudgetExceeded = errors.New("ahocorasick: size budget exceeded")
+
+// MatchMode tells how a word may match in a text.
+type MatchMode byte
+
+const (
+	// Substring matches the word anywhere, which is the default.
+	Substring MatchMode = iota
+	// WholeWord matches the word only when it's not surrounded by word
+	// bytes, i.e. ASCII letters, digits and '_'.
+	WholeWord
+)
+
+// ErrUnsortedAfterSort is returned by BuildE when the sorted words are not in
+// byte-wise order, which the double array construction relies on.
+var ErrUnsortedAfterSort = errors.New("ahocorasick: words not in byte-wise order after sort")
+
 // Builder is an interface to create AC.
 type Builder struct {
 	// input
-	words      []string
-	wordValues []interface{}
+	words          []string
+	wordValues     []interface{}
+	wordModes      []MatchMode
+	wordWeights    []float64
+	wordTags       []int // tag set index, 0 for the empty set
+	wordOrder      []int // insertion index
+	wordByteValues [][]byte
+
+	// options
+	remap            bool
+	alphabet         []byte // byte -> compact label, 0 for unused bytes
+	labels           []byte // compact label -> byte
+	rejectSubstrings bool
+	requireUTF8      bool
+	maxArrayLen      int
+	dedup            bool
+	logf             func(format string, args ...interface{})
+	onState          func(state, depth int, terminal bool)
+	reverse          bool
+	normalize        func(string) string
+	escapeNull       bool
+	caseInsensitive  bool
+	bloom            bool
+	maxDepth         int
+	runeSafe         bool
 
 	// tries
 	base       []int // reused to store value index when represented '\0'
 	check      []int
 	suffixLink []int
 	values     []interface{}
+	modes      []MatchMode // by value index, nil if all the words are Substring
+	weights    []float64   // by value index, nil if no word is weighted
+	weighted   bool
+	tags       []int // tag set index by value index, nil if no word is tagged
+	tagIDs     map[string]int
+	tagSets    [][]int // sorted tag ids, the 1-st is the empty set
+	tagSetIDs  map[string]int
+	order      []int    // insertion index of each word in trie order
+	byteValues [][]byte // by value index, nil if no word is added by AddBytes
+	hasBytes   bool
 
 	entries   []*entryState
 	headEntry *entryState
+	built     bool
+	stats     BuildStats
+}
+
+// BuildStats counts the work done to place the states in the double array.
+type BuildStats struct {
+	Collisions int // candidate positions rejected as some label slot is used
+	Extensions int // blocks appended to the arrays
 }
 
 // Searcher is an interface to search over AC.
@@ -29,6 +107,25 @@ type Searcher struct {
 	check      []int
 	suffixLink []int
 	values     []interface{}
+	alphabet   []byte
+	labels     []byte
+	modes      []MatchMode
+	weights    []float64
+	tags       []int
+	tagIDs     map[string]int
+	tagSets    [][]int
+	order      []int
+	byteValues [][]byte
+	reversed   bool
+	normalize  func(string) string
+	folded     bool // ASCII upper case bytes mapped onto lower case labels
+	escapeNull bool // '\0' has a label of its own
+	bloom      *bloomFilter
+	lazy       *lazyValues // values loaded on first access, by ReadStructure
+	fixedLen   int         // length shared by all the words, 0 if they differ
+	maxWordLen int
+
+	hasSuffixLinks bool
 }
 
 type entryState struct {
@@ -71,8 +168,13 @@ func (es *entryState) linkAsPrev(other *entryState) {
 }
 
 type wordSorter struct {
-	words  []string
-	values []interface{}
+	words   []string
+	values  []interface{}
+	modes   []MatchMode
+	weights []float64
+	tags    []int
+	order   []int
+	bytes   [][]byte
 }
 
 func (ws *wordSorter) Len() int {
@@ -86,6 +188,11 @@ func (ws *wordSorter) Less(i, j int) bool {
 func (ws *wordSorter) Swap(i, j int) {
 	sort.StringSlice(ws.words).Swap(i, j)
 	ws.values[i], ws.values[j] = ws.values[j], ws.values[i]
+	ws.modes[i], ws.modes[j] = ws.modes[j], ws.modes[i]
+	ws.weights[i], ws.weights[j] = ws.weights[j], ws.weights[i]
+	ws.tags[i], ws.tags[j] = ws.tags[j], ws.tags[i]
+	ws.order[i], ws.order[j] = ws.order[j], ws.order[i]
+	ws.bytes[i], ws.bytes[j] = ws.bytes[j], ws.bytes[i]
 }
 
 // NewBuilder creates a new AC builder
@@ -95,26 +202,711 @@ func NewBuilder() *Builder {
 
 // Add inserts candidate words
 func (b *Builder) Add(word string, value interface{}) *Builder {
+	return b.AddWithMode(word, value, Substring)
+}
+
+// AddWord inserts a candidate word valued by its insertion index, i.e. the
+// number of words added before it.
+func (b *Builder) AddWord(word string) *Builder {
+	return b.Add(word, len(b.words))
+}
+
+// Sourced is the value stored by AddFrom.
+type Sourced struct {
+	Source string
+	Word   string
+}
+
+// AddFrom inserts the words of a labeled list, each valued by a Sourced of
+// `source` and itself. A word found in several lists is a duplicate like
+// any other, so only the source added first is kept.
+func (b *Builder) AddFrom(source string, words []string) *Builder {
+	for _, word := range words {
+		b.Add(word, Sourced{source, word})
+	}
+	return b
+}
+
+// AddWithMode inserts a candidate word matching as told by `mode`.
+func (b *Builder) AddWithMode(word string, value interface{}, mode MatchMode) *Builder {
+	if b.built {
+		panic("Builder already consumed.")
+	}
+	if b.normalize != nil {
+		word = b.normalize(word)
+	}
+	if b.caseInsensitive {
+		word = foldASCII(word)
+	}
+	if b.maxDepth > 0 && len(word) > b.maxDepth {
+		n := b.maxDepth
+		for b.runeSafe && n > 0 && !utf8.RuneStart(word[n]) {
+			n--
+		}
+		if n == 0 {
+			// keep the first character whole, longer than `k` as it is
+			_, n = utf8.DecodeRuneInString(word)
+		}
+		word = word[:n]
+	}
 	if len(word) == 0 {
 		panic("Add empty word.")
 	}
+	b.wordOrder = append(b.wordOrder, len(b.words))
 	b.words = append(b.words, word)
 	b.wordValues = append(b.wordValues, value)
+	b.wordModes = append(b.wordModes, mode)
+	b.wordWeights = append(b.wordWeights, 0)
+	b.wordTags = append(b.wordTags, 0)
+	b.wordByteValues = append(b.wordByteValues, nil)
+	return b
+}
+
+// AddBytes inserts a candidate word valued by `value`, which
+// CoverBytesValues returns as is, e.g. the replacement of the word. The
+// word is also valued by `value` for the other APIs, which box it once into
+// the interface values.
+func (b *Builder) AddBytes(word string, value []byte) *Builder {
+	b.Add(word, value)
+	b.wordByteValues[len(b.wordByteValues)-1] = value
+	b.hasBytes = true
+	return b
+}
+
+// AddWeighted inserts a candidate word carrying `weight`, which is summed by
+// CoverScore. Words added otherwise weigh 0.
+func (b *Builder) AddWeighted(word string, value interface{}, weight float64) *Builder {
+	b.Add(word, value)
+	b.wordWeights[len(b.wordWeights)-1] = weight
+	b.weighted = true
+	return b
+}
+
+// AddTagged inserts a candidate word labeled by `tags`, which CoverByTag
+// filters on. Tags are interned, so each distinct tag set is stored once.
+func (b *Builder) AddTagged(word string, value interface{}, tags ...string) *Builder {
+	b.Add(word, value)
+	b.tagLast(tags)
+	return b
+}
+
+// tagLast sets the tag set of the word added last.
+func (b *Builder) tagLast(tags []string) {
+	if b.tagIDs == nil {
+		b.tagIDs = make(map[string]int)
+		b.tagSets = [][]int{nil}
+		b.tagSetIDs = map[string]int{fmt.Sprint([]int{}): 0}
+	}
+	var ids []int
+	for _, tag := range tags {
+		id, ok := b.tagIDs[tag]
+		if !ok {
+			id = len(b.tagIDs)
+			b.tagIDs[tag] = id
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	n := 0
+	for i, id := range ids {
+		if i == 0 || ids[n-1] != id {
+			ids[n] = id
+			n++
+		}
+	}
+	ids = ids[:n]
+	key := fmt.Sprint(ids)
+	set, ok := b.tagSetIDs[key]
+	if !ok {
+		set = len(b.tagSets)
+		b.tagSetIDs[key] = set
+		b.tagSets = append(b.tagSets, ids)
+	}
+	b.wordTags[len(b.wordTags)-1] = set
+}
+
+const (
+	digitBytes = "0123456789"
+	wordBytes  = digitBytes + "ABCDEFGHIJKLMNOPQRSTUVWXYZ_abcdefghijklmnopqrstuvwxyz"
+)
+
+// AddPattern inserts the words matching `pattern`, where `\d` stands for any
+// ASCII digit, `\w` for any word byte as told by WholeWord and `\\` for a
+// backslash. Each expanded word is added with `value`, so the size grows
+// with the product of the class sizes, and Cover reports `value` once per
+// distinct expansion found.
+func (b *Builder) AddPattern(pattern string, value interface{}) *Builder {
+	words := []string{""}
+	for i := 0; i < len(pattern); i++ {
+		set := pattern[i : i+1]
+		if pattern[i] == '\\' {
+			if i++; i == len(pattern) {
+				panic("Dangling escape in pattern.")
+			}
+			switch pattern[i] {
+			case 'd':
+				set = digitBytes
+			case 'w':
+				set = wordBytes
+			case '\\':
+				set = `\`
+			default:
+				panic(fmt.Sprintf("Unknown escape \\%c in pattern.", pattern[i]))
+			}
+		}
+		next := make([]string, 0, len(words)*len(set))
+		for _, word := range words {
+			for j := 0; j < len(set); j++ {
+				next = append(next, word+set[j:j+1])
+			}
+		}
+		words = next
+	}
+	for _, word := range words {
+		b.Add(word, value)
+	}
+	return b
+}
+
+// RemapAlphabet maps the bytes used by the words onto a compact label range
+// at build time, which shrinks the double array for narrow alphabets.
+func (b *Builder) RemapAlphabet() *Builder {
+	b.remap = true
+	return b
+}
+
+// EscapeNull allows words containing '\0', which otherwise marks where words
+// end in the trie, by enabling RemapAlphabet so '\0' gets a label of its
+// own. Texts are scanned as is, at the cost of the alphabet lookup per byte,
+// but the words may then use at most 255 distinct bytes.
+func (b *Builder) EscapeNull() *Builder {
+	b.escapeNull = true
+	b.remap = true
+	return b
+}
+
+// CaseInsensitive matches ASCII letters regardless of their case, by
+// lowering the words when added and mapping upper case bytes onto the
+// labels of lower case ones in the remapped alphabet it enables. Texts are
+// scanned as is, so offsets are those in the original text. It must be set
+// before adding words.
+func (b *Builder) CaseInsensitive() *Builder {
+	b.caseInsensitive = true
+	b.remap = true
+	return b
+}
+
+// WithBloom builds a Bloom filter over the words for Search and Contains to
+// reject most of the words not in the dictionary without walking the trie,
+// which pays off when most queries miss. It costs about 10 bits per word.
+func (b *Builder) WithBloom() *Builder {
+	b.bloom = true
+	return b
+}
+
+// foldASCII lowers the ASCII letters of `text`.
+func foldASCII(text string) string {
+	for i := 0; i < len(text); i++ {
+		if c := text[i]; 'A' <= c && c <= 'Z' {
+			ret := []byte(text)
+			for j := i; j < len(ret); j++ {
+				if c := ret[j]; 'A' <= c && c <= 'Z' {
+					ret[j] = c - 'A' + 'a'
+				}
+			}
+			return string(ret)
+		}
+	}
+	return text
+}
+
+// RejectSubstrings makes BuildE fail if any word is a substring of another,
+// which guarantees that matches never overlap.
+func (b *Builder) RejectSubstrings() *Builder {
+	b.rejectSubstrings = true
+	return b
+}
+
+// RequireValidUTF8 makes BuildE fail if any word, as stored after Normalize
+// and MaxDepth, is not valid UTF-8.
+func (b *Builder) RequireValidUTF8() *Builder {
+	b.requireUTF8 = true
+	return b
+}
+
+// MaxArrayLen caps the length of the automaton arrays, so BuildE returns
+// ErrSizeBudgetExceeded instead of growing them beyond `n`.
+func (b *Builder) MaxArrayLen(n int) *Builder {
+	b.maxArrayLen = n
+	return b
+}
+
+// Dedup drops repeated words before building, keeping the value added
+// first, instead of logging them one by one.
+func (b *Builder) Dedup() *Builder {
+	b.dedup = true
+	return b
+}
+
+// Logger routes the diagnostics of the build, such as duplicated words, to
+// `logf`. They are dropped by default.
+func (b *Builder) Logger(logf func(format string, args ...interface{})) *Builder {
+	b.logf = logf
+	return b
+}
+
+// OnState sets a callback invoked for every state of the trie, root
+// included, once its transitions are placed during the build. `terminal`
+// tells whether a word ends at the state.
+func (b *Builder) OnState(fn func(state, depth int, terminal bool)) *Builder {
+	b.onState = fn
+	return b
+}
+
+// Normalize applies `fn` to the words when added and to the texts and
+// queries before searching, since bytes only match when both sides share one
+// form, e.g. norm.NFC.String of golang.org/x/text/unicode/norm for Unicode
+// normalization. It must be set before adding words and `fn` should be
+// idempotent. Offsets reported by the searcher are then those in the
+// normalized text.
+func (b *Builder) Normalize(fn func(string) string) *Builder {
+	b.normalize = fn
 	return b
 }
 
-// Build create a new searcher from the builder
+// WhitespaceNormalized collapses each run of ASCII whitespace into a single
+// space and trims it at both ends, in the words when added and in the texts
+// and queries before searching, so that "cat   dog" is seen as "cat dog" by
+// CoverTokens and the others. It applies after a Normalize set before it,
+// and must be set before adding words.
+func (b *Builder) WhitespaceNormalized() *Builder {
+	next := b.normalize
+	b.normalize = func(text string) string {
+		if next != nil {
+			text = next(text)
+		}
+		return collapseSpace(text)
+	}
+	return b
+}
+
+// collapseSpace replaces runs of ASCII whitespace in `text` by one space and
+// trims them at both ends.
+func collapseSpace(text string) string {
+	var ret []byte
+	pending := false // whitespace seen after some other byte
+	for i := 0; i < len(text); i++ {
+		if c := text[i]; !isSpace(c) {
+			if pending {
+				ret = append(ret, ' ')
+				pending = false
+			}
+			ret = append(ret, c)
+		} else if len(ret) > 0 {
+			pending = true
+		}
+	}
+	return string(ret)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\v' || c == '\f' || c == '\r'
+}
+
+// MaxDepth truncates the words to their first `k` bytes when added, which
+// builds a coarse prefix index. Words sharing a truncated prefix are then
+// duplicates, so the value added first is kept. It must be set before adding
+// words.
+func (b *Builder) MaxDepth(k int) *Builder {
+	b.maxDepth = k
+	return b
+}
+
+// RuneSafe makes MaxDepth truncate words at a UTF-8 character boundary,
+// possibly keeping fewer than its `k` bytes, or more for a first character
+// longer than `k`, which is kept whole.
+func (b *Builder) RuneSafe() *Builder {
+	b.runeSafe = true
+	return b
+}
+
+// ReverseMatch stores the words reversed byte by byte, for CoverSuffixes to
+// match them as suffixes. All the other methods of the searcher then see the
+// reversed words. Reversing splits multi-byte UTF-8 sequences, which is fine
+// for matching as both sides are reversed but not for anything expecting
+// valid UTF-8 from the trie.
+func (b *Builder) ReverseMatch() *Builder {
+	b.reverse = true
+	return b
+}
+
+// Build create a new searcher from the builder, which can't be used any
+// more afterwards.
 func (b *Builder) Build() *Searcher {
-	sort.StringSlice(b.words).Sort()
+	if b.built {
+		panic("Builder already consumed.")
+	}
+	b.built = true
+	if b.reverse {
+		for i, word := range b.words {
+			b.words[i] = reverseString(word)
+		}
+	}
+	if b.dedup {
+		b.dedupWords()
+	}
+	b.sortWords()
+	if err := checkSorted(b.words); err != nil {
+		panic(err)
+	}
+	if b.remap {
+		b.buildAlphabet()
+	}
+	if b.caseInsensitive {
+		for c := 'A'; c <= 'Z'; c++ {
+			b.alphabet[c] = b.alphabet[c-'A'+'a']
+		}
+	}
 	b.values = make([]interface{}, 1) // 1-st not used
+	for _, mode := range b.wordModes {
+		if mode != Substring {
+			b.modes = make([]MatchMode, 1)
+			break
+		}
+	}
+	if b.weighted {
+		b.weights = make([]float64, 1)
+	}
+	if b.tagSets != nil {
+		b.tags = make([]int, 1)
+	}
+	if b.hasBytes {
+		b.byteValues = make([][]byte, 1)
+	}
 	b.extendBlocks()
-	b.buildLevel(0, len(b.words), 0, 0)
-	b.buildSuffixLinks()
-	return &Searcher{b.base, b.check, b.suffixLink, b.values}
+	if len(b.words) > 0 {
+		b.buildLevel(0, len(b.words), 0, 0)
+		b.buildSuffixLinks()
+	}
+	var bloom *bloomFilter
+	if b.bloom {
+		bloom = newBloomFilter(b.words, b.caseInsensitive)
+	}
+	return &Searcher{
+		base:       b.base,
+		check:      b.check,
+		suffixLink: b.suffixLink,
+		values:     b.values,
+		alphabet:   b.alphabet,
+		labels:     b.labels,
+		modes:      b.modes,
+		weights:    b.weights,
+		tags:       b.tags,
+		tagIDs:     b.tagIDs,
+		tagSets:    b.tagSets,
+		order:      b.order,
+		byteValues: b.byteValues,
+		reversed:   b.reverse,
+		normalize:  b.normalize,
+		folded:     b.caseInsensitive,
+		escapeNull: b.escapeNull,
+		bloom:      bloom,
+		fixedLen:   b.fixedLen(),
+		maxWordLen: b.maxWordLen(),
+
+		hasSuffixLinks: b.hasSuffixLinks(),
+	}
+}
+
+func (b *Builder) fixedLen() int {
+	if len(b.words) == 0 {
+		return 0
+	}
+	n := len(b.words[0])
+	for _, word := range b.words {
+		if len(word) != n {
+			return 0
+		}
+	}
+	return n
+}
+
+func (b *Builder) maxWordLen() int {
+	n := 0
+	for _, word := range b.words {
+		if len(word) > n {
+			n = len(word)
+		}
+	}
+	return n
+}
+
+func (b *Builder) hasSuffixLinks() bool {
+	for i, link := range b.suffixLink {
+		if link != 0 && b.check[i] >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func reverseString(s string) string {
+	bytes := make([]byte, len(s))
+	for i := 0; i < len(s); i++ {
+		bytes[len(s)-1-i] = s[i]
+	}
+	return string(bytes)
+}
+
+// sortWords sorts the words keeping the insertion order of duplicates. Both
+// buildLevel and buildSuffixLinks group the words by their bytes at each
+// depth, so any order other than the byte-wise one breaks the construction.
+func (b *Builder) sortWords() {
+	sort.Stable(&wordSorter{b.words, b.wordValues, b.wordModes, b.wordWeights, b.wordTags, b.wordOrder, b.wordByteValues})
+}
+
+// checkSorted returns ErrUnsortedAfterSort unless `words` are in byte-wise
+// order, as sortWords leaves them.
+func checkSorted(words []string) error {
+	for i := 1; i < len(words); i++ {
+		if words[i-1] > words[i] {
+			return ErrUnsortedAfterSort
+		}
+	}
+	return nil
+}
+
+// EstimateSize returns a lower bound of the bytes SizeBytes will report after
+// building, from the number of trie nodes of the words added so far, as
+// Build stores them. The double array usually has some free slots on top of
+// it.
+func (b *Builder) EstimateSize() int {
+	words := make([]string, len(b.words))
+	for i, word := range b.words {
+		if b.reverse {
+			word = reverseString(word)
+		}
+		words[i] = word
+	}
+	sort.Strings(words)
+	nodes := 1 // root
+	for i, word := range words {
+		if i > 0 && words[i-1] == word {
+			continue
+		}
+		common := 0
+		if i > 0 {
+			prev := words[i-1]
+			for common < len(prev) && common < len(word) && prev[common] == word[common] {
+				common++
+			}
+		}
+		nodes += len(word) - common + 1 // new nodes and the '\0' slot
+	}
+	n := (nodes + blockSize - 1) / blockSize * blockSize
+	return n * 3 * (strconv.IntSize / 8)
+}
+
+func (b *Builder) dedupWords() {
+	seen := make(map[string]struct{}, len(b.words))
+	n := 0
+	for i, word := range b.words {
+		if _, ok := seen[word]; ok {
+			continue
+		}
+		seen[word] = struct{}{}
+		b.words[n] = word
+		b.wordValues[n] = b.wordValues[i]
+		b.wordModes[n] = b.wordModes[i]
+		b.wordWeights[n] = b.wordWeights[i]
+		b.wordTags[n] = b.wordTags[i]
+		b.wordOrder[n] = b.wordOrder[i]
+		b.wordByteValues[n] = b.wordByteValues[i]
+		n++
+	}
+	b.words = b.words[:n]
+	b.wordValues = b.wordValues[:n]
+	b.wordModes = b.wordModes[:n]
+	b.wordWeights = b.wordWeights[:n]
+	b.wordTags = b.wordTags[:n]
+	b.wordOrder = b.wordOrder[:n]
+	b.wordByteValues = b.wordByteValues[:n]
+}
+
+// buildAlphabet assigns labels 1..k to the used bytes in ascending order, so
+// the byte-wise order of the sorted words is kept.
+func (b *Builder) buildAlphabet() {
+	var used [256]bool
+	for _, word := range b.words {
+		for i := 0; i < len(word); i++ {
+			used[word[i]] = true
+		}
+	}
+	b.alphabet = make([]byte, 256)
+	b.labels = make([]byte, 1, 256)
+	var label byte
+	for c := 0; c < len(used); c++ {
+		if used[c] {
+			if label == 255 {
+				panic("Too many distinct bytes to remap '\\0'.")
+			}
+			label++
+			b.alphabet[c] = label
+			b.labels = append(b.labels, byte(c))
+		}
+	}
+}
+
+// BuildWithStats is like Build but also returns the placement statistics,
+// e.g. to tell whether RemapAlphabet is worth enabling.
+func (b *Builder) BuildWithStats() (*Searcher, BuildStats) {
+	s := b.Build()
+	return s, b.stats
+}
+
+// SafeBuild is like Build but converts any panic raised while building into
+// a returned error, so untrusted dictionaries cannot crash the caller.
+func (b *Builder) SafeBuild() (s *Searcher, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s = nil
+			if e, ok := r.(error); ok {
+				err = e
+			} else {
+				err = fmt.Errorf("ahocorasick: %v", r)
+			}
+		}
+	}()
+	return b.Build(), nil
+}
+
+// BuildE is like SafeBuild but also runs the validations enabled on the
+// builder against the built searcher.
+func (b *Builder) BuildE() (*Searcher, error) {
+	if b.requireUTF8 {
+		// before Build, which may reverse the words byte by byte
+		if err := b.checkUTF8(); err != nil {
+			return nil, err
+		}
+	}
+	s, err := b.SafeBuild()
+	if err != nil {
+		return nil, err
+	}
+	if b.rejectSubstrings {
+		if err := b.checkSubstrings(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// BuildFromChan adds the words received from `ch` until it's closed and
+// builds a searcher from them, so words can be ingested as they arrive. The
+// channel is always drained, even if an empty word is received.
+func BuildFromChan(ch <-chan struct {
+	Word  string
+	Value interface{}
+}) (*Searcher, error) {
+	b := NewBuilder()
+	var err error
+	for w := range ch {
+		if len(w.Word) == 0 {
+			if err == nil {
+				err = errors.New("ahocorasick: empty word")
+			}
+			continue
+		}
+		b.Add(w.Word, w.Value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b.BuildE()
+}
+
+// BuildFromFS builds a searcher from the file `name` of `fsys`, e.g. an
+// embed.FS, holding one word per line. Lines are trimmed and blank ones
+// skipped. Each word is valued by `value` of it, or by itself if `value` is
+// nil.
+func BuildFromFS(fsys fs.FS, name string, value func(line string) interface{}) (*Searcher, error) {
+	fp, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	b := NewBuilder()
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		if value != nil {
+			b.Add(line, value(line))
+		} else {
+			b.Add(line, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return b.BuildE()
+}
+
+// checkSubstrings covers each word with the searcher built from all of them
+// and reports any other word found inside it.
+func (b *Builder) checkSubstrings(s *Searcher) error {
+	var pairs []string
+	seen := make(map[string]struct{})
+	for i, word := range b.words {
+		if i > 0 && b.words[i-1] == word {
+			continue
+		}
+		s.scan(word, func(state, index, end int) bool {
+			start := end - s.depth(state)
+			if start == 0 && end == len(word) {
+				return true
+			}
+			sub, super := word[start:end], word
+			if b.reverse {
+				sub, super = reverseString(sub), reverseString(super)
+			}
+			pair := fmt.Sprintf("%q in %q", sub, super)
+			if _, ok := seen[pair]; !ok {
+				seen[pair] = struct{}{}
+				pairs = append(pairs, pair)
+			}
+			return true
+		})
+	}
+	if len(pairs) > 0 {
+		return fmt.Errorf("%w: %s", ErrSubstringWords, strings.Join(pairs, ", "))
+	}
+	return nil
+}
+
+// checkUTF8 reports the words which are not valid UTF-8.
+func (b *Builder) checkUTF8() error {
+	var invalid []string
+	for _, word := range b.words {
+		if !utf8.ValidString(word) {
+			invalid = append(invalid, strconv.Quote(word))
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidUTF8, strings.Join(invalid, ", "))
+	}
+	return nil
 }
 
 func (b *Builder) extendBlocks() {
+	b.stats.Extensions++
 	start := len(b.base)
+	if b.maxArrayLen > 0 && start+blockSize > b.maxArrayLen {
+		panic(ErrSizeBudgetExceeded)
+	}
 	for i := 0; i < blockSize; i++ {
 		b.base = append(b.base, 0)
 		b.check = append(b.check, -1)
@@ -149,6 +941,9 @@ func (b *Builder) buildLevel(begin, end, depth, state int) {
 		nc := next + int(l)
 		b.check[nc] = state
 	}
+	if b.onState != nil {
+		b.onState(state, depth, labels[0] == 0)
+	}
 
 	// Go depth
 	for i, l := range labels {
@@ -157,8 +952,21 @@ func (b *Builder) buildLevel(begin, end, depth, state int) {
 			// save value
 			b.base[nc] = len(b.values)
 			b.values = append(b.values, b.wordValues[bs[i]])
+			if b.modes != nil {
+				b.modes = append(b.modes, b.wordModes[bs[i]])
+			}
+			if b.weights != nil {
+				b.weights = append(b.weights, b.wordWeights[bs[i]])
+			}
+			if b.tags != nil {
+				b.tags = append(b.tags, b.wordTags[bs[i]])
+			}
+			b.order = append(b.order, b.wordOrder[bs[i]])
+			if b.byteValues != nil {
+				b.byteValues = append(b.byteValues, b.wordByteValues[bs[i]])
+			}
 			if bs[i+1]-bs[i] > 1 {
-				log.Printf("skip duplicated value for word: %v", b.words[bs[i]])
+				b.logPrintf("skip duplicated value for word: %v", b.words[bs[i]])
 			}
 			continue
 		}
@@ -166,6 +974,12 @@ func (b *Builder) buildLevel(begin, end, depth, state int) {
 	}
 }
 
+func (b *Builder) logPrintf(format string, args ...interface{}) {
+	if b.logf != nil {
+		b.logf(format, args...)
+	}
+}
+
 type suffixLink struct {
 	state int
 	begin int
@@ -198,7 +1012,7 @@ func (b *Builder) buildSuffixLinks() {
 			for i, l := range labels {
 				nc := next + int(l)
 				if sl.state != 0 {
-					b.createSuffixLink(sl.state, nc, l)
+					createSuffixLink(b.base, b.check, b.suffixLink, sl.state, nc, l)
 				}
 				if l == 0 {
 					continue
@@ -211,28 +1025,34 @@ func (b *Builder) buildSuffixLinks() {
 	}
 }
 
-func (b *Builder) createSuffixLink(state, childState int, c byte) {
-	suffix := b.suffixLink[state]
+// createSuffixLink links `childState`, reached from `state` by `c`, to the
+// longest proper suffix of its path in the trie, given the links of the
+// shallower states.
+func createSuffixLink(base, check, suffixLink []int, state, childState int, c byte) {
+	suffix := suffixLink[state]
 	// do while?
 	for {
-		tmp := b.base[suffix] + int(c)
-		if b.check[tmp] == suffix {
-			b.suffixLink[childState] = tmp
+		tmp := base[suffix] + int(c)
+		if tmp < len(check) && check[tmp] == suffix {
+			suffixLink[childState] = tmp
 			break
 		}
 		if suffix == 0 {
 			break
 		}
-		suffix = b.suffixLink[suffix]
+		suffix = suffixLink[suffix]
 	}
 }
 
 func (b *Builder) getCharacter(i, j int) byte {
 	if j < len(b.words[i]) {
 		c := b.words[i][j]
-		if c == 0 {
+		if c == 0 && !b.escapeNull {
 			panic("Word contains '\\0'")
 		}
+		if b.alphabet != nil {
+			return b.alphabet[c]
+		}
 		return c
 	}
 	return 0
@@ -255,6 +1075,7 @@ func (b *Builder) findNextPosition(labels []byte) int {
 				nc := i + int(l)
 				if b.entries[nc].used {
 					ok = false
+					b.stats.Collisions++
 					break
 				}
 			}
@@ -290,17 +1111,19 @@ func (b *Builder) findNextPosition(labels []byte) int {
 		b.entries[nc].used = true
 		b.entries[nc].unlink()
 	}
-	b.entries[p].used = true
-	b.entries[p].unlink()
+	// p is already taken when '\0' is one of the labels
+	if !b.entries[p].used {
+		b.entries[p].used = true
+		b.entries[p].unlink()
+	}
 	return p
 }
 
 func (s *Searcher) prefixSearch(word string) (int, bool) {
 	state := 0
-	bytes := []byte(word)
-	for _, c := range bytes {
-		nextState := s.base[state] + int(c)
-		if nextState >= len(s.check) || s.check[nextState] != state {
+	for i := 0; i < len(word); i++ {
+		nextState, ok := s.child(state, word[i])
+		if !ok {
 			return -1, false
 		}
 		state = nextState
@@ -308,58 +1131,1132 @@ func (s *Searcher) prefixSearch(word string) (int, bool) {
 	return state, true
 }
 
-// Search returns true if there's a exactly match.
-func (s *Searcher) Search(word string) (bool, interface{}) {
-	state, ok := s.prefixSearch(word)
-	if !ok {
-		return false, false
+// prepare turns a text or query into the form the words were stored in.
+func (s *Searcher) prepare(text string) string {
+	if s.normalize != nil {
+		text = s.normalize(text)
 	}
-	nextState := s.base[state]
-	if nextState < len(s.check) && s.check[nextState] == state {
-		return true, s.values[s.base[nextState]]
+	return text
+}
+
+// child follows the transition for `c` from `state` without any fallback.
+func (s *Searcher) child(state int, c byte) (int, bool) {
+	if s.alphabet != nil {
+		c = s.alphabet[c]
 	}
-	return false, nil
+	// label 0 leads to the slot holding the value index of a terminal
+	if c == 0 {
+		return -1, false
+	}
+	return s.childLabel(state, c)
 }
 
-// PrefixSearch returns true if some words which are prefix for the given `word`.
-func (s *Searcher) PrefixSearch(word string) bool {
-	_, ok := s.prefixSearch(word)
-	return ok
+// childLabel is like child but takes the label as stored in the trie.
+func (s *Searcher) childLabel(state int, l byte) (int, bool) {
+	nextState := s.base[state] + int(l)
+	if nextState >= len(s.check) || s.check[nextState] != state {
+		return -1, false
+	}
+	return nextState, true
 }
 
-// Cover returns all the values of words which are covered by thte given `text`.
-func (s *Searcher) Cover(text string) []interface{} {
-	ret := make([]interface{}, 0)
-	state := 0
-	seen := make(map[int]struct{})
-	bytes := []byte(text)
-	for _, c := range bytes {
-		for {
-			nextState := s.base[state] + int(c)
-			if nextState < len(s.check) && s.check[nextState] == state {
-				state = nextState
-				break
-			}
-			if state == 0 {
-				break
-			}
-			state = s.suffixLink[state]
-		}
+// isTerminal returns the value index stored in the '\0' slot of `state`, or
+// false if no word ends there.
+func (s *Searcher) isTerminal(state int) (valueIndex int, ok bool) {
+	endState := s.base[state] + 0
+	if endState >= len(s.check) || s.check[endState] != state {
+		return 0, false
+	}
+	return s.base[endState], true
+}
 
-		checkState := state
-		for {
+// value returns the value at `index`, loading it first for a searcher read
+// by ReadStructure.
+func (s *Searcher) value(index int) interface{} {
+	if s.lazy != nil {
+		s.lazy.load(s, index)
+	}
+	return s.values[index]
+}
+
+// loadValues loads all the values of a searcher read by ReadStructure.
+func (s *Searcher) loadValues() {
+	for index := range s.values {
+		s.value(index)
+	}
+}
+
+// valueIndex returns the value index held by terminal `state`.
+func (s *Searcher) valueIndex(state int) int {
+	return s.base[s.base[state]]
+}
+
+// step follows the transition for `c` from `state`, falling back along the
+// suffix links until a transition exists or root is reached.
+func (s *Searcher) step(state int, c byte) int {
+	return s.stepCounted(state, c, nil)
+}
+
+// stepCounted is like step but adds the suffix links followed to `hops`
+// unless nil.
+func (s *Searcher) stepCounted(state int, c byte, hops *int) int {
+	if s.alphabet != nil {
+		c = s.alphabet[c]
+	}
+	if c == 0 {
+		return 0
+	}
+	for {
+		nextState := s.base[state] + int(c)
+		if nextState < len(s.check) && s.check[nextState] == state {
+			return nextState
+		}
+		if state == 0 {
+			return 0
+		}
+		state = s.suffixLink[state]
+		if hops != nil {
+			*hops++
+		}
+	}
+}
+
+// Step moves the automaton from `state` over the byte `c` and returns the
+// new state. Root is state 0, so a scan starts from Step(0, text[0]).
+func (s *Searcher) Step(state int, c byte) int {
+	return s.step(state, c)
+}
+
+// IsTerminal returns true if a word ends at `state`, like those ValueAt
+// finds a value for.
+func (s *Searcher) IsTerminal(state int) bool {
+	_, ok := s.ValueAt(state)
+	return ok
+}
+
+// ValueAt returns the value stored for the word ending at `state`, or false
+// if no word ends there.
+func (s *Searcher) ValueAt(state int) (interface{}, bool) {
+	if state < 0 || state >= len(s.check) {
+		return nil, false
+	}
+	// skip free slots and the '\0' slots holding value indexes
+	if parent := s.check[state]; state != 0 && (parent < 0 || s.base[parent] == state) {
+		return nil, false
+	}
+	index, ok := s.isTerminal(state)
+	if !ok {
+		return nil, false
+	}
+	return s.value(index), true
+}
+
+// fits reports whether the word ending at terminal `state` may match with
+// the bytes `before` and `after` it, -1 at the edges of the text.
+func (s *Searcher) fits(state, before, after int) bool {
+	if s.modes == nil || s.modes[s.valueIndex(state)] != WholeWord {
+		return true
+	}
+	return (before < 0 || !isWordByte(byte(before))) && (after < 0 || !isWordByte(byte(after)))
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// depth returns the length of the path from root to `state`, which is the
+// byte length of the word ending at a terminal state.
+func (s *Searcher) depth(state int) int {
+	d := 0
+	for state != 0 {
+		state = s.check[state]
+		d++
+	}
+	return d
+}
+
+// HasSuffixLinks returns true if any state links to a non-root suffix, i.e.
+// matches may overlap and Cover has to walk the suffix links.
+func (s *Searcher) HasSuffixLinks() bool {
+	return s.hasSuffixLinks
+}
+
+// Warm touches the automaton arrays page by page to fault them in, e.g.
+// right after loading a searcher, so the first searches are not slowed down
+// by cold pages.
+func (s *Searcher) Warm() {
+	stride := os.Getpagesize() / (strconv.IntSize / 8)
+	sum := 0
+	for _, arr := range [][]int{s.base, s.check, s.suffixLink} {
+		for i := 0; i < len(arr); i += stride {
+			sum += arr[i]
+		}
+		if len(arr) > 0 {
+			sum += arr[len(arr)-1]
+		}
+	}
+	// keep the reads from being optimized away, without sharing a sink
+	// between concurrent calls
+	runtime.KeepAlive(sum)
+}
+
+// AutomatonStats describes the structure of a built searcher.
+type AutomatonStats struct {
+	States      int     // trie nodes including root
+	Terminals   int     // states where a word ends
+	SuffixLinks int     // states linking to a non-root suffix
+	ArrayLen    int     // length of the double array
+	LoadFactor  float64 // used slots / total slots
+}
+
+// Stats returns the structural metrics of the searcher.
+func (s *Searcher) Stats() AutomatonStats {
+	var st AutomatonStats
+	used := 0
+	for i, parent := range s.check {
+		switch {
+		case i == 0:
+			st.States++
+		case parent < 0:
+			continue
+		case s.base[parent] == i:
+			// '\0' slot of a terminal
+			st.Terminals++
+		default:
+			st.States++
+			if s.suffixLink[i] != 0 {
+				st.SuffixLinks++
+			}
+		}
+		used++
+	}
+	st.ArrayLen = len(s.check)
+	if st.ArrayLen > 0 {
+		st.LoadFactor = float64(used) / float64(st.ArrayLen)
+	}
+	return st
+}
+
+// LengthHistogram maps each byte length to the number of distinct words of
+// that length in the dictionary.
+func (s *Searcher) LengthHistogram() map[int]int {
+	ret := make(map[int]int)
+	for i, parent := range s.check {
+		if i != 0 && parent >= 0 && s.base[parent] == i {
+			ret[s.depth(parent)]++
+		}
+	}
+	return ret
+}
+
+// IsEmpty tells whether no words were indexed, i.e. there's no terminal
+// state and nothing can ever match.
+func (s *Searcher) IsEmpty() bool {
+	for i, parent := range s.check {
+		if i != 0 && parent >= 0 && s.base[parent] == i {
+			return false
+		}
+	}
+	return true
+}
+
+// TerminalStates returns the states where words end, in ascending order.
+func (s *Searcher) TerminalStates() []int {
+	ret := make([]int, 0)
+	for i, parent := range s.check {
+		if i != 0 && parent >= 0 && s.base[parent] == i {
+			ret = append(ret, parent)
+		}
+	}
+	sort.Ints(ret)
+	return ret
+}
+
+// Validate checks the invariants of the double array, i.e. every transition
+// points back to a used state within the label range, every state climbs
+// back to root through its parents, every suffix link targets a shallower
+// used state, only terminals hold a negative base and every terminal holds a
+// value index in range. It returns an error describing the first broken one,
+// which is meant to catch corruption by mutating APIs like Compact in tests.
+func (s *Searcher) Validate() error {
+	n := len(s.check)
+	if len(s.base) != n || len(s.suffixLink) != n {
+		return fmt.Errorf("ahocorasick: array lengths %d/%d/%d differ", len(s.base), n, len(s.suffixLink))
+	}
+	if s.modes != nil && len(s.modes) != len(s.values) {
+		return fmt.Errorf("ahocorasick: %d modes for %d values", len(s.modes), len(s.values))
+	}
+	if s.weights != nil && len(s.weights) != len(s.values) {
+		return fmt.Errorf("ahocorasick: %d weights for %d values", len(s.weights), len(s.values))
+	}
+	if s.tags != nil && len(s.tags) != len(s.values) {
+		return fmt.Errorf("ahocorasick: %d tag sets for %d values", len(s.tags), len(s.values))
+	}
+	if s.byteValues != nil && len(s.byteValues) != len(s.values) {
+		return fmt.Errorf("ahocorasick: %d byte values for %d values", len(s.byteValues), len(s.values))
+	}
+	labels := 256
+	if s.labels != nil {
+		labels = len(s.labels)
+	}
+	if n == 0 {
+		return errors.New("ahocorasick: no root state")
+	}
+	if s.base[0] < 0 {
+		return fmt.Errorf("ahocorasick: root has negative base %d", s.base[0])
+	}
+	used := func(state int) bool {
+		return state == 0 || (state > 0 && state < n && s.check[state] >= 0)
+	}
+	// every used state must climb back to root through `check`, and the
+	// climb gives its depth, while -1 marks the states of the current climb
+	depths := make([]int, n)
+	var chain []int
+	for i, parent := range s.check {
+		if i == 0 || parent < 0 {
+			continue
+		}
+		chain = chain[:0]
+		state := i
+		for state != 0 && depths[state] == 0 {
+			if !used(s.check[state]) {
+				return fmt.Errorf("ahocorasick: state %d has unused parent %d", state, s.check[state])
+			}
+			depths[state] = -1
+			chain = append(chain, state)
+			state = s.check[state]
+		}
+		if state != 0 && depths[state] < 0 {
+			return fmt.Errorf("ahocorasick: state %d is on a cycle of parents", state)
+		}
+		d := depths[state]
+		for k := len(chain) - 1; k >= 0; k-- {
+			d++
+			depths[chain[k]] = d
+		}
+	}
+	for i, parent := range s.check {
+		if i == 0 || parent < 0 {
+			continue
+		}
+		if !used(parent) {
+			return fmt.Errorf("ahocorasick: state %d has unused parent %d", i, parent)
+		}
+		if parent != 0 && s.base[s.check[parent]] == parent {
+			return fmt.Errorf("ahocorasick: state %d has terminal parent %d", i, parent)
+		}
+		if l := i - s.base[parent]; l < 0 || l >= labels {
+			return fmt.Errorf("ahocorasick: transition %d->%d out of label range", parent, i)
+		}
+		if i == s.base[parent] {
+			if index := s.base[i]; index < 0 || index >= len(s.values) {
+				return fmt.Errorf("ahocorasick: terminal %d has value index %d out of range", i, index)
+			}
+			continue
+		}
+		if s.base[i] < 0 {
+			return fmt.Errorf("ahocorasick: state %d has negative base %d", i, s.base[i])
+		}
+		if link := s.suffixLink[i]; !used(link) || (link != 0 && s.base[s.check[link]] == link) || depths[link] >= depths[i] {
+			return fmt.Errorf("ahocorasick: state %d has suffix link to invalid state %d", i, link)
+		}
+	}
+	return nil
+}
+
+// Arrays returns copies of the double array, e.g. to share a prebuilt
+// automaton with consumers in other languages. Terminals hold indexes into
+// the values in their `base`, as described by Validate.
+func (s *Searcher) Arrays() (base, check, suffixLink []int) {
+	base = append([]int(nil), s.base...)
+	check = append([]int(nil), s.check...)
+	suffixLink = append([]int(nil), s.suffixLink...)
+	return base, check, suffixLink
+}
+
+// NewSearcherFromArrays creates a searcher over arrays as returned by Arrays
+// and the `values` they index, which are used as is. Options that are not
+// part of the arrays, like RemapAlphabet, Normalize or WholeWord modes, are
+// lost. It returns the error from Validate for inconsistent arrays.
+func NewSearcherFromArrays(base, check, suffixLink []int, values []interface{}) (*Searcher, error) {
+	s := &Searcher{
+		base:       base,
+		check:      check,
+		suffixLink: suffixLink,
+		values:     values,
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	s.deriveLengths()
+	return s, nil
+}
+
+// NewSearcherComputingLinks is like NewSearcherFromArrays for arrays without
+// suffix links, which are computed breadth-first from the trie in `base` and
+// `check` like Build does from the words.
+func NewSearcherComputingLinks(base, check []int, values []interface{}) (*Searcher, error) {
+	s := &Searcher{
+		base:       base,
+		check:      check,
+		suffixLink: make([]int, len(base)),
+		values:     values,
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	// the children of each state, by ascending label
+	children := make([][]int, len(check))
+	for i, parent := range check {
+		if i != 0 && parent >= 0 {
+			children[parent] = append(children[parent], i)
+		}
+	}
+	q := []int{0}
+	for len(q) > 0 {
+		var nextQ []int
+		for _, state := range q {
+			for _, child := range children[state] {
+				l := byte(child - base[state])
+				if state != 0 {
+					createSuffixLink(s.base, s.check, s.suffixLink, state, child, l)
+				}
+				if l != 0 {
+					nextQ = append(nextQ, child)
+				}
+			}
+		}
+		q = nextQ
+	}
+	s.deriveLengths()
+	return s, nil
+}
+
+// deriveLengths sets maxWordLen and hasSuffixLinks from the arrays, for
+// searchers not made by a builder.
+func (s *Searcher) deriveLengths() {
+	for i, parent := range s.check {
+		if i == 0 || parent < 0 {
+			continue
+		}
+		if s.base[parent] == i {
+			if d := s.depth(parent); d > s.maxWordLen {
+				s.maxWordLen = d
+			}
+		} else if s.suffixLink[i] != 0 {
+			s.hasSuffixLinks = true
+		}
+	}
+}
+
+// Compact shrinks the memory held by the searcher. It must not run
+// concurrently with searches.
+func (s *Searcher) Compact() {
+	s.compactValues()
+}
+
+// compactValues renumbers the value indexes densely, sharing one slot among
+// terminals of equal comparable values, and drops the unused slots.
+func (s *Searcher) compactValues() {
+	s.loadValues()
+	s.lazy = nil
+	type key struct {
+		value  interface{}
+		mode   MatchMode
+		weight float64
+		tags   int
+	}
+	var values []interface{}
+	var modes []MatchMode
+	var weights []float64
+	var tags []int
+	var byteValues [][]byte
+	indexes := make(map[key]int)
+	for i, parent := range s.check {
+		if i == 0 || parent < 0 || s.base[parent] != i {
+			continue
+		}
+		val := s.values[s.base[i]]
+		var k key
+		comparable := val == nil || reflect.ValueOf(val).Comparable()
+		if comparable {
+			k.value = val
+			if s.modes != nil {
+				k.mode = s.modes[s.base[i]]
+			}
+			if s.weights != nil {
+				k.weight = s.weights[s.base[i]]
+			}
+			if s.tags != nil {
+				k.tags = s.tags[s.base[i]]
+			}
+			if index, ok := indexes[k]; ok {
+				s.base[i] = index
+				continue
+			}
+			indexes[k] = len(values)
+		}
+		if s.modes != nil {
+			modes = append(modes, s.modes[s.base[i]])
+		}
+		if s.weights != nil {
+			weights = append(weights, s.weights[s.base[i]])
+		}
+		if s.tags != nil {
+			tags = append(tags, s.tags[s.base[i]])
+		}
+		if s.byteValues != nil {
+			byteValues = append(byteValues, s.byteValues[s.base[i]])
+		}
+		s.base[i] = len(values)
+		values = append(values, val)
+	}
+	s.values = values
+	if s.modes != nil {
+		s.modes = modes
+	}
+	if s.weights != nil {
+		s.weights = weights
+	}
+	if s.tags != nil {
+		s.tags = tags
+	}
+	if s.byteValues != nil {
+		s.byteValues = byteValues
+	}
+}
+
+// SizeBytes returns the approximate memory held by the automaton arrays and
+// the Bloom filter of WithBloom, excluding the stored values themselves.
+func (s *Searcher) SizeBytes() int {
+	n := len(s.base) + len(s.check) + len(s.suffixLink)
+	n = n*(strconv.IntSize/8) + len(s.alphabet)
+	if s.bloom != nil {
+		n += s.bloom.sizeBytes()
+	}
+	return n
+}
+
+// Equal reports whether both searchers hold the same automaton arrays and
+// deeply equal values. Builder options not reflected in the arrays, like
+// Normalize, are not compared.
+func (s *Searcher) Equal(other *Searcher) bool {
+	s.loadValues()
+	other.loadValues()
+	return reflect.DeepEqual(s.base, other.base) &&
+		reflect.DeepEqual(s.check, other.check) &&
+		reflect.DeepEqual(s.suffixLink, other.suffixLink) &&
+		reflect.DeepEqual(s.values, other.values)
+}
+
+// Search returns true and the stored value if there's a exactly match, or
+// false and nil otherwise.
+func (s *Searcher) Search(word string) (bool, interface{}) {
+	word = s.prepare(word)
+	if s.fixedLen > 0 && len(word) != s.fixedLen {
+		return false, nil
+	}
+	if s.bloom != nil && !s.bloom.mayContain(word) {
+		return false, nil
+	}
+	state, ok := s.prefixSearch(word)
+	if !ok {
+		return false, nil
+	}
+	if index, ok := s.isTerminal(state); ok {
+		return true, s.value(index)
+	}
+	return false, nil
+}
+
+// SearchRunes is like Search on string(runes) but encodes the runes on the
+// fly instead of allocating the string.
+func (s *Searcher) SearchRunes(runes []rune) (bool, interface{}) {
+	if s.normalize != nil {
+		return s.Search(string(runes))
+	}
+	var buf [utf8.UTFMax]byte
+	state := 0
+	length := 0
+	for _, r := range runes {
+		n := utf8.EncodeRune(buf[:], r)
+		length += n
+		for _, c := range buf[:n] {
+			nextState, ok := s.child(state, c)
+			if !ok {
+				return false, nil
+			}
+			state = nextState
+		}
+	}
+	if s.fixedLen > 0 && length != s.fixedLen {
+		return false, nil
+	}
+	if index, ok := s.isTerminal(state); ok {
+		return true, s.value(index)
+	}
+	return false, nil
+}
+
+// Contains returns true if the given `word` is exactly in the dictionary.
+func (s *Searcher) Contains(word string) bool {
+	word = s.prepare(word)
+	if s.fixedLen > 0 && len(word) != s.fixedLen {
+		return false
+	}
+	if s.bloom != nil && !s.bloom.mayContain(word) {
+		return false
+	}
+	state, ok := s.prefixSearch(word)
+	if !ok {
+		return false
+	}
+	_, ok = s.isTerminal(state)
+	return ok
+}
+
+// Lookup tells in one walk whether `word` is exactly in the dictionary, with
+// its value, and whether some longer words start with it.
+func (s *Searcher) Lookup(word string) (value interface{}, exact bool, hasLonger bool) {
+	state, ok := s.prefixSearch(s.prepare(word))
+	if !ok {
+		return nil, false, false
+	}
+	if index, ok := s.isTerminal(state); ok {
+		value, exact = s.value(index), true
+	}
+	for l := 1; l < 256; l++ {
+		if _, ok := s.childLabel(state, byte(l)); ok {
+			hasLonger = true
+			break
+		}
+	}
+	return value, exact, hasLonger
+}
+
+// MatchPrefixAt0 returns the value of the longest word that is a prefix of
+// the given `text`, i.e. a match anchored at offset 0, or false if no word
+// is. Unlike PrefixSearch, the text may run past the words.
+func (s *Searcher) MatchPrefixAt0(text string) (interface{}, bool) {
+	_, index, found := s.longestPrefix(s.prepare(text))
+	if !found {
+		return nil, false
+	}
+	return s.value(index), true
+}
+
+// LongestPrefixValue returns the longest word that is a prefix of `query`,
+// as stored, with its value, e.g. "a/b" for "a/b/c" over {"a", "a/b"} to
+// look up routing tables. Under CaseInsensitive the prefix is in lower case,
+// like the stored word, whatever the case of `query`.
+func (s *Searcher) LongestPrefixValue(query string) (prefix string, value interface{}, ok bool) {
+	query = s.prepare(query)
+	n, index, found := s.longestPrefix(query)
+	if !found {
+		return "", nil, false
+	}
+	prefix = query[:n]
+	if s.folded {
+		prefix = foldASCII(prefix)
+	}
+	return prefix, s.value(index), true
+}
+
+// SearchOrPrefix returns the value of `query` if it's a word, or else of the
+// longest word prefixing it, with the byte length of the matched word as
+// stored. Since a word is its own longest prefix, it's LongestPrefixValue
+// without building the prefix.
+func (s *Searcher) SearchOrPrefix(query string) (value interface{}, matchedLen int, ok bool) {
+	n, index, found := s.longestPrefix(s.prepare(query))
+	if !found {
+		return nil, 0, false
+	}
+	return s.value(index), n, true
+}
+
+// longestPrefix returns the byte length and value index of the longest word
+// that is a prefix of `text`.
+func (s *Searcher) longestPrefix(text string) (n, index int, found bool) {
+	state := 0
+	for i := 0; i < len(text); i++ {
+		nextState, ok := s.child(state, text[i])
+		if !ok {
+			break
+		}
+		state = nextState
+		if valueIndex, ok := s.isTerminal(state); ok {
+			n, index, found = i+1, valueIndex, true
+		}
+	}
+	return n, index, found
+}
+
+// FixedLen returns the byte length shared by all the words, if any, which
+// lets Search reject queries of other lengths without walking the trie.
+func (s *Searcher) FixedLen() (int, bool) {
+	return s.fixedLen, s.fixedLen > 0
+}
+
+// MaxWordLen returns the byte length of the longest word.
+func (s *Searcher) MaxWordLen() int {
+	return s.maxWordLen
+}
+
+// IndexOf returns the index of an exactly matched word added by AddWord, or
+// false if there's no match or its value is not an int.
+func (s *Searcher) IndexOf(word string) (int, bool) {
+	ok, value := s.Search(word)
+	if !ok {
+		return -1, false
+	}
+	index, ok := value.(int)
+	if !ok {
+		return -1, false
+	}
+	return index, true
+}
+
+// PrefixSearch returns true if some words which are prefix for the given `word`.
+func (s *Searcher) PrefixSearch(word string) bool {
+	_, ok := s.prefixSearch(s.prepare(word))
+	return ok
+}
+
+// SearchWildcard returns the values of all words which exactly match the
+// given `pattern`, where each `wildcard` byte matches any single byte.
+func (s *Searcher) SearchWildcard(pattern string, wildcard byte) []interface{} {
+	pattern = s.prepare(pattern)
+	frontier := []int{0}
+	for i := 0; i < len(pattern) && len(frontier) > 0; i++ {
+		var next []int
+		for _, state := range frontier {
+			if pattern[i] != wildcard {
+				if nextState, ok := s.child(state, pattern[i]); ok {
+					next = append(next, nextState)
+				}
+				continue
+			}
+			for l := 1; l < 256; l++ {
+				if nextState, ok := s.childLabel(state, byte(l)); ok {
+					next = append(next, nextState)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	ret := make([]interface{}, 0)
+	for _, state := range frontier {
+		if index, ok := s.isTerminal(state); ok {
+			if val := s.value(index); val != nil {
+				ret = append(ret, val)
+			}
+		}
+	}
+	return ret
+}
+
+// Cover returns all the values of words which are covered by thte given `text`.
+func (s *Searcher) Cover(text string) []interface{} {
+	return s.CoverInto(text, make([]interface{}, 0))
+}
+
+// CoverInto appends the values of words covered by the given `text` to `dst`
+// and returns the extended slice, like `append`. Passing the previous result
+// with length 0 reuses its capacity across calls.
+func (s *Searcher) CoverInto(text string, dst []interface{}) []interface{} {
+	return s.cover(text, dst, make(map[int]struct{}), nil)
+}
+
+// CoverTyped is like Cover but only keeps the values of type `T`, skipping
+// the others. It's a function as methods can't take type parameters.
+func CoverTyped[T any](s *Searcher, text string) []T {
+	ret := make([]T, 0)
+	for _, val := range s.Cover(text) {
+		if v, ok := val.(T); ok {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// CoverMany returns the distinct values covered by any of the given `texts`,
+// in the order they're first found, sharing the visited states among texts.
+func (s *Searcher) CoverMany(texts []string) []interface{} {
+	ret := make([]interface{}, 0)
+	seen := make(map[int]struct{})
+	for _, text := range texts {
+		ret = s.cover(text, ret, seen, nil)
+	}
+	return ret
+}
+
+// UnusedWords returns the values of the words matched by none of the given
+// `texts`, ordered by terminal state like TerminalStates, e.g. to prune dead
+// entries of a blocklist.
+func (s *Searcher) UnusedWords(texts []string) []interface{} {
+	matched := make(map[int]struct{})
+	seen := make(map[int]struct{})
+	for _, text := range texts {
+		s.coverStates(text, coverScan{seen: seen}, func(state, index int) {
+			matched[state] = struct{}{}
+		})
+	}
+	ret := make([]interface{}, 0)
+	for _, state := range s.TerminalStates() {
+		if _, ok := matched[state]; ok {
+			continue
+		}
+		if val := s.value(s.valueIndex(state)); val != nil {
+			ret = append(ret, val)
+		}
+	}
+	return ret
+}
+
+// CoverMinLen is like Cover but skips words shorter than `minBytes` bytes.
+func (s *Searcher) CoverMinLen(text string, minBytes int) []interface{} {
+	return s.cover(text, make([]interface{}, 0), make(map[int]struct{}), func(state, index int) bool {
+		return s.depth(state) >= minBytes
+	})
+}
+
+// CoverMaxPerPos is like Cover but takes at most `maxPerPos` of the words
+// ending at each position, from the longest, and drops the shorter ones
+// there. Words taken at an earlier position count even if not collected
+// again, which bounds the terminal checks per byte on inputs like "aaaa"
+// over {"a", "aa", "aaa"}.
+func (s *Searcher) CoverMaxPerPos(text string, maxPerPos int) []interface{} {
+	text = s.prepare(text)
+	ret := make([]interface{}, 0)
+	seen := make(map[int]struct{})
+	state := 0
+	for i := 0; i < len(text); i++ {
+		state = s.step(state, text[i])
+		n := 0
+		for checkState := state; checkState != 0 && n < maxPerPos; checkState = s.suffixLink[checkState] {
+			index, ok := s.isTerminal(checkState)
+			if !ok || (s.modes != nil && !s.fitsAt(text, checkState, i+1)) {
+				continue
+			}
+			n++
 			if _, ok := seen[checkState]; ok {
-				break
+				continue
 			}
 			seen[checkState] = struct{}{}
-			endState := s.base[checkState] + 0
-			if s.check[endState] == checkState {
-				if val := s.values[s.base[endState]]; val != nil {
-					ret = append(ret, val)
+			if val := s.value(index); val != nil {
+				ret = append(ret, val)
+			}
+		}
+	}
+	return ret
+}
+
+// CoverFiltered is like Cover but only collects the values accepted by
+// `keep`, checked while scanning.
+func (s *Searcher) CoverFiltered(text string, keep func(value interface{}) bool) []interface{} {
+	return s.cover(text, make([]interface{}, 0), make(map[int]struct{}), func(state, index int) bool {
+		val := s.value(index)
+		return val != nil && keep(val)
+	})
+}
+
+// IsClean returns true if the given `text` covers no words, i.e. it's the
+// same as len(Cover(text)) == 0 but stops at the first match.
+func (s *Searcher) IsClean(text string) bool {
+	clean := true
+	s.scan(text, func(state, index, end int) bool {
+		if s.value(index) != nil {
+			clean = false
+		}
+		return clean
+	})
+	return clean
+}
+
+// HasAtLeast returns true if the given `text` covers at least `k` distinct
+// words, i.e. it's the same as len(Cover(text)) >= k but stops once the
+// k-th is found.
+func (s *Searcher) HasAtLeast(text string, k int) bool {
+	if k <= 0 {
+		return true
+	}
+	seen := make(map[int]struct{}, k)
+	s.scan(text, func(state, index, end int) bool {
+		if s.value(index) != nil {
+			seen[state] = struct{}{}
+		}
+		return len(seen) < k
+	})
+	return len(seen) >= k
+}
+
+// ContainsValue returns true if some word valued by `target` occurs in the
+// given `text`, stopping at the first one. Values must be comparable.
+func (s *Searcher) ContainsValue(text string, target interface{}) bool {
+	found := false
+	s.scan(text, func(state, index, end int) bool {
+		if val := s.value(index); val != nil && val == target {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// CoverWithScratch is like Cover but uses `seen` to track the visited
+// states instead of allocating a map, e.g. one from a sync.Pool. The map is
+// cleared first and left holding the states of this scan.
+func (s *Searcher) CoverWithScratch(text string, seen map[int]struct{}) []interface{} {
+	for state := range seen {
+		delete(seen, state)
+	}
+	return s.cover(text, make([]interface{}, 0), seen, nil)
+}
+
+// timeoutCheckBytes is how many bytes CoverTimeout scans between checks of
+// the clock.
+const timeoutCheckBytes = 4096
+
+// CoverTimeout is like Cover but gives up once `d` has elapsed, returning
+// the values found so far and false. The clock is checked every
+// timeoutCheckBytes bytes, so the scan may overrun `d` by that much.
+func (s *Searcher) CoverTimeout(text string, d time.Duration) ([]interface{}, bool) {
+	ret := make([]interface{}, 0)
+	c := coverScan{seen: make(map[int]struct{}), deadline: time.Now().Add(d)}
+	done := s.coverStates(text, c, func(state, index int) {
+		if val := s.value(index); val != nil {
+			ret = append(ret, val)
+		}
+	})
+	return ret, done
+}
+
+// ScanMetrics counts the work done by CoverWithMetrics.
+type ScanMetrics struct {
+	Transitions    int // bytes stepped over
+	SuffixHops     int // suffix links followed, on mismatches and to collect words
+	TerminalChecks int // states checked for a word ending there
+}
+
+// CoverWithMetrics is like Cover but also counts the work done by the scan,
+// e.g. to profile worst-case inputs.
+func (s *Searcher) CoverWithMetrics(text string) ([]interface{}, ScanMetrics) {
+	var m ScanMetrics
+	ret := make([]interface{}, 0)
+	s.coverStates(text, coverScan{seen: make(map[int]struct{}), metrics: &m}, func(state, index int) {
+		if val := s.value(index); val != nil {
+			ret = append(ret, val)
+		}
+	})
+	return ret, m
+}
+
+// cover appends the distinct values covered by `text` to `dst`, keeping only
+// the terminal states accepted by `keep` when it's not nil. States in `seen`
+// are taken as already visited.
+func (s *Searcher) cover(text string, dst []interface{}, seen map[int]struct{}, keep func(state, index int) bool) []interface{} {
+	ret := dst
+	s.coverStates(text, coverScan{seen: seen, keep: keep}, func(state, index int) {
+		if val := s.value(index); val != nil {
+			ret = append(ret, val)
+		}
+	})
+	return ret
+}
+
+// coverScan holds the options of coverStates.
+type coverScan struct {
+	seen     map[int]struct{}            // states taken as visited
+	keep     func(state, index int) bool // terminal states to take, all if nil
+	metrics  *ScanMetrics                // counts the work if not nil
+	deadline time.Time                   // checked every timeoutCheckBytes bytes if not zero
+}
+
+// coverStates calls `visit` with each distinct terminal state covered by
+// `text` and accepted by `keep`, in the order of Cover, and its value index,
+// even for a nil value. It returns false if the deadline passed first.
+func (s *Searcher) coverStates(text string, c coverScan, visit func(state, index int)) bool {
+	text = s.prepare(text)
+	m := c.metrics
+	var hops *int
+	if m != nil {
+		hops = &m.SuffixHops
+	}
+	state := 0
+	for i := 0; i < len(text); i++ {
+		if !c.deadline.IsZero() && i > 0 && i%timeoutCheckBytes == 0 && time.Now().After(c.deadline) {
+			return false
+		}
+		if m != nil {
+			m.Transitions++
+		}
+		state = s.stepCounted(state, text[i], hops)
+
+		// all the links point to root, which is never terminal
+		if !s.hasSuffixLinks && s.modes == nil && m == nil {
+			if _, ok := c.seen[state]; ok {
+				continue
+			}
+			c.seen[state] = struct{}{}
+			if index, ok := s.isTerminal(state); ok && (c.keep == nil || c.keep(state, index)) {
+				visit(state, index)
+			}
+			continue
+		}
+		for checkState := state; checkState != 0; checkState = s.suffixLink[checkState] {
+			if _, ok := c.seen[checkState]; ok {
+				// a WholeWord state may be rejected at one position but
+				// accepted later, so the states linked from a visited one
+				// may still have to be checked
+				if s.modes == nil {
+					break
 				}
+				if m != nil {
+					m.SuffixHops++
+				}
+				continue
+			}
+			if m != nil {
+				m.TerminalChecks++
+			}
+			index, ok := s.isTerminal(checkState)
+			if ok && s.modes != nil && !s.fitsAt(text, checkState, i+1) {
+				if m != nil {
+					m.SuffixHops++
+				}
+				continue
+			}
+			c.seen[checkState] = struct{}{}
+			if ok && (c.keep == nil || c.keep(checkState, index)) {
+				visit(checkState, index)
 			}
-			checkState = s.suffixLink[checkState]
+			if m != nil {
+				m.SuffixHops++
+			}
+		}
+	}
+	return true
+}
+
+// CoverWeighted sums `weight` over every occurrence of words in the given
+// `text`, passing the value and byte length of each matched word.
+func (s *Searcher) CoverWeighted(text string, weight func(value interface{}, length int) float64) float64 {
+	var sum float64
+	s.scan(text, func(state, index, end int) bool {
+		if val := s.value(index); val != nil {
+			sum += weight(val, s.depth(state))
 		}
+		return true
+	})
+	return sum
+}
+
+// CoverScore sums the weights set by AddWeighted of the distinct words
+// covered by the given `text`, like those Cover returns.
+func (s *Searcher) CoverScore(text string) float64 {
+	var sum float64
+	if s.weights == nil {
+		return sum
+	}
+	s.coverStates(text, coverScan{seen: make(map[int]struct{})}, func(state, index int) {
+		if s.value(index) != nil {
+			sum += s.weights[index]
+		}
+	})
+	return sum
+}
+
+// CoverByTag is like Cover but only collects the values of words added by
+// AddTagged with `tag` among their tags.
+func (s *Searcher) CoverByTag(text string, tag string) []interface{} {
+	id, ok := s.tagIDs[tag]
+	if !ok || s.tags == nil {
+		return make([]interface{}, 0)
 	}
+	return s.cover(text, make([]interface{}, 0), make(map[int]struct{}), func(state, index int) bool {
+		set := s.tagSets[s.tags[index]]
+		i := sort.SearchInts(set, id)
+		return i < len(set) && set[i] == id
+	})
+}
+
+// CoverBytesValues is like Cover but returns the values of words added by
+// AddBytes as []byte, without type assertions, skipping the other words.
+func (s *Searcher) CoverBytesValues(text string) [][]byte {
+	ret := make([][]byte, 0)
+	if s.byteValues == nil {
+		return ret
+	}
+	s.coverStates(text, coverScan{seen: make(map[int]struct{})}, func(state, index int) {
+		if val := s.byteValues[index]; val != nil {
+			ret = append(ret, val)
+		}
+	})
 	return ret
 }
+
+// CoverCapped counts the occurrences of each value of words in the given
+// `text`, up to `perValue` per value. Values must be comparable to be used
+// as map keys.
+func (s *Searcher) CoverCapped(text string, perValue int) map[interface{}]int {
+	ret := make(map[interface{}]int)
+	s.scan(text, func(state, index, end int) bool {
+		if val := s.value(index); val != nil && ret[val] < perValue {
+			ret[val]++
+		}
+		return true
+	})
+	return ret
+}
+
+// CoverStats accumulates matches over many calls to CoverAccumulate.
+type CoverStats struct {
+	Counts map[interface{}]int // occurrences per value
+	Texts  int                 // texts scanned
+	Bytes  int64               // bytes scanned
+}
+
+// CoverAccumulate adds the occurrences of each value of words in the given
+// `text` to `stats`, making its Counts if nil. Values must be comparable to
+// be used as map keys.
+func (s *Searcher) CoverAccumulate(text string, stats *CoverStats) {
+	if stats.Counts == nil {
+		stats.Counts = make(map[interface{}]int)
+	}
+	stats.Texts++
+	stats.Bytes += int64(len(text))
+	s.scan(text, func(state, index, end int) bool {
+		if val := s.value(index); val != nil {
+			stats.Counts[val]++
+		}
+		return true
+	})
+}
+
+// DiffCover compares the values `a` and `b` cover in the given `text` as
+// sets, returning those only found by each of them in the order of Cover.
+// Values must be comparable to be used as map keys.
+func DiffCover(a, b *Searcher, text string) (onlyA, onlyB []interface{}) {
+	retA, retB := a.Cover(text), b.Cover(text)
+	inA := make(map[interface{}]struct{}, len(retA))
+	for _, val := range retA {
+		inA[val] = struct{}{}
+	}
+	inB := make(map[interface{}]struct{}, len(retB))
+	for _, val := range retB {
+		inB[val] = struct{}{}
+	}
+	onlyA, onlyB = make([]interface{}, 0), make([]interface{}, 0)
+	for _, val := range retA {
+		if _, ok := inB[val]; !ok {
+			onlyA = append(onlyA, val)
+		}
+	}
+	for _, val := range retB {
+		if _, ok := inA[val]; !ok {
+			onlyB = append(onlyB, val)
+		}
+	}
+	return onlyA, onlyB
+}
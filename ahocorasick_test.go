@@ -1,8 +1,14 @@
 package ahocorasick
 
 import (
+	"errors"
+	"fmt"
 	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 func TestSearch(t *testing.T) {
@@ -39,6 +45,209 @@ func TestSearch(t *testing.T) {
 	}
 }
 
+func TestContains(t *testing.T) {
+	builder := NewBuilder()
+	words := []string{"hello", "world"}
+	for _, word := range words {
+		builder.Add(word, word)
+	}
+	searcher := builder.Build()
+
+	for _, word := range words {
+		if !searcher.Contains(word) {
+			t.Errorf("Fail to contain '%v'", word)
+		}
+	}
+	for _, word := range []string{"hell", "w", "helm", "wa", "hello!"} {
+		if searcher.Contains(word) {
+			t.Errorf("Unexpected contain '%v'", word)
+		}
+	}
+}
+
+func TestSearchNoValue(t *testing.T) {
+	searcher := NewBuilder().Add("hello", "hello").Build()
+	ok, value := searcher.Search("helm")
+	if ok {
+		t.Error("Unexpected match 'helm'")
+	}
+	if value != nil {
+		t.Errorf("Expect nil value for a non-match, got %#v", value)
+	}
+
+	// both the failed walk and the non-terminal prefix give nil
+	for _, word := range []string{"missing", "hell"} {
+		_, value := searcher.Search(word)
+		switch value.(type) {
+		case nil:
+		default:
+			t.Errorf("Expect nil value for '%v', got %#v", word, value)
+		}
+	}
+}
+
+func TestValueAt(t *testing.T) {
+	searcher := NewBuilder().Add("hello", "hello").Add("world", "world").Build()
+	state := 0
+	for _, c := range []byte("hello") {
+		state = searcher.Step(state, c)
+		if c == 'l' {
+			if _, ok := searcher.ValueAt(state); ok {
+				t.Error("Unexpected value at an intermediate state")
+			}
+		}
+	}
+	if value, ok := searcher.ValueAt(state); !ok || value != "hello" {
+		t.Errorf("Unexpected value %v at the state of 'hello'", value)
+	}
+	if _, ok := searcher.ValueAt(-1); ok {
+		t.Error("Unexpected value at an invalid state")
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	searcher := NewBuilder().Add("hello", 1).Add("hell", 2).Build()
+	state := 0
+	for i, c := range []byte("hello") {
+		state = searcher.Step(state, c)
+		if terminal := searcher.IsTerminal(state); terminal != (i >= 3) {
+			t.Errorf("Unexpected terminal %v after '%s'", terminal, "hello"[:i+1])
+		}
+	}
+	if searcher.IsTerminal(0) || searcher.IsTerminal(-1) || searcher.IsTerminal(len(searcher.check)) {
+		t.Error("Unexpected terminal out of the words")
+	}
+}
+
+func TestAddFrom(t *testing.T) {
+	searcher := NewBuilder().
+		AddFrom("A", []string{"spam", "both"}).
+		AddFrom("B", []string{"ham", "both"}).
+		Build()
+	ret := searcher.Cover("spam and ham")
+	if len(ret) != 2 {
+		t.Fatal("Fail to cover enough words:", ret)
+	}
+	if v := ret[0].(Sourced); v.Source != "A" || v.Word != "spam" {
+		t.Errorf("Unexpected value %+v", v)
+	}
+	// "ham" is also found inside "spam", reported once
+	if v := ret[1].(Sourced); v.Source != "B" || v.Word != "ham" {
+		t.Errorf("Unexpected value %+v", v)
+	}
+	if _, value := searcher.Search("both"); value.(Sourced).Source != "A" {
+		t.Errorf("Unexpected source for a duplicated word: %+v", value)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	searcher := NewBuilder().Add("go", "go").Add("golang", "golang").Build()
+	cases := []struct {
+		word      string
+		value     interface{}
+		exact     bool
+		hasLonger bool
+	}{
+		{"go", "go", true, true},
+		{"golang", "golang", true, false},
+		{"gol", nil, false, true},
+		{"rust", nil, false, false},
+	}
+	for _, c := range cases {
+		value, exact, hasLonger := searcher.Lookup(c.word)
+		if value != c.value || exact != c.exact || hasLonger != c.hasLonger {
+			t.Errorf("Unexpected lookup of '%v': (%v, %v, %v)", c.word, value, exact, hasLonger)
+		}
+	}
+}
+
+func TestMatchPrefixAt0(t *testing.T) {
+	searcher := NewBuilder().Add("http", "http").Add("https", "https").Add("x", "x").Build()
+	if value, ok := searcher.MatchPrefixAt0("https://x"); !ok || value != "https" {
+		t.Errorf("Unexpected value %v for 'https://x'", value)
+	}
+	if value, ok := searcher.MatchPrefixAt0("httpx"); !ok || value != "http" {
+		t.Errorf("Unexpected value %v for 'httpx'", value)
+	}
+	if _, ok := searcher.MatchPrefixAt0("ftp://x"); ok {
+		t.Error("Unexpected match not starting at 0")
+	}
+}
+
+func TestLongestPrefixValue(t *testing.T) {
+	searcher := NewBuilder().Add("a", 1).Add("a/b", 2).Build()
+	if prefix, value, ok := searcher.LongestPrefixValue("a/b/c"); !ok || prefix != "a/b" || value != 2 {
+		t.Errorf("Unexpected prefix (%v, %v, %v) for 'a/b/c'", prefix, value, ok)
+	}
+	if prefix, value, ok := searcher.LongestPrefixValue("a/c"); !ok || prefix != "a" || value != 1 {
+		t.Errorf("Unexpected prefix (%v, %v, %v) for 'a/c'", prefix, value, ok)
+	}
+	if _, _, ok := searcher.LongestPrefixValue("b/a"); ok {
+		t.Error("Unexpected prefix for 'b/a'")
+	}
+
+	// the stored key is returned, not the case of the query
+	searcher = NewBuilder().CaseInsensitive().Add("Api", 1).Add("api/V1", 2).Build()
+	if prefix, value, ok := searcher.LongestPrefixValue("API/v1/users"); !ok || prefix != "api/v1" || value != 2 {
+		t.Errorf("Unexpected prefix (%v, %v, %v) for 'API/v1/users'", prefix, value, ok)
+	}
+}
+
+func TestSearchOrPrefix(t *testing.T) {
+	searcher := NewBuilder().Add("app", "app").Add("apple", "apple").Build()
+	if value, n, ok := searcher.SearchOrPrefix("application"); !ok || value != "app" || n != 3 {
+		t.Errorf("Unexpected match (%v, %v, %v) for 'application'", value, n, ok)
+	}
+	if value, n, ok := searcher.SearchOrPrefix("apple"); !ok || value != "apple" || n != 5 {
+		t.Errorf("Unexpected match (%v, %v, %v) for 'apple'", value, n, ok)
+	}
+	if _, _, ok := searcher.SearchOrPrefix("ap"); ok {
+		t.Error("Unexpected match for 'ap'")
+	}
+}
+
+func TestFixedLen(t *testing.T) {
+	searcher := NewBuilder().Add("abcd", 1).Add("wxyz", 2).Build()
+	if n, ok := searcher.FixedLen(); !ok || n != 4 {
+		t.Errorf("Unexpected fixed length (%v, %v)", n, ok)
+	}
+	if ok, value := searcher.Search("abc"); ok || value != nil {
+		t.Error("Unexpected match for a 3-byte query")
+	}
+	if ok, value := searcher.Search("wxyz"); !ok || value != 2 {
+		t.Error("Fail to match 'wxyz'")
+	}
+
+	searcher = NewBuilder().Add("abcd", 1).Add("abc", 2).Build()
+	if _, ok := searcher.FixedLen(); ok {
+		t.Error("Unexpected fixed length for words of different lengths")
+	}
+	if ok, _ := searcher.Search("abc"); !ok {
+		t.Error("Fail to match 'abc'")
+	}
+}
+
+func TestIndexOf(t *testing.T) {
+	builder := NewBuilder()
+	words := []string{"world", "hello", "abc"}
+	for _, word := range words {
+		builder.AddWord(word)
+	}
+	builder.Add("text", "not an index")
+	searcher := builder.Build()
+	for i, word := range words {
+		if index, ok := searcher.IndexOf(word); !ok || index != i {
+			t.Errorf("Unexpected index %v for '%v'", index, word)
+		}
+	}
+	if _, ok := searcher.IndexOf("text"); ok {
+		t.Error("Unexpected index for a non-int value")
+	}
+	if _, ok := searcher.IndexOf("hell"); ok {
+		t.Error("Unexpected index for a missing word")
+	}
+}
+
 func TestSearchCN(t *testing.T) {
 	builder := NewBuilder()
 	words := []string{"犹豫就会败北"}
@@ -65,6 +274,42 @@ func TestSearchCN(t *testing.T) {
 	}
 }
 
+func TestSearchWildcard(t *testing.T) {
+	for _, remap := range []bool{false, true} {
+		builder := NewBuilder()
+		if remap {
+			builder.RemapAlphabet()
+		}
+		words := []string{"cat", "cot", "cut", "cute", "dog"}
+		for _, word := range words {
+			builder.Add(word, word)
+		}
+		searcher := builder.Build()
+		ret := searcher.SearchWildcard("c?t", '?')
+		if len(ret) != 3 || ret[0] != "cat" || ret[1] != "cot" || ret[2] != "cut" {
+			t.Error("Unexpected wildcard matches:", ret)
+		}
+		if ret := searcher.SearchWildcard("??g", '?'); len(ret) != 1 || ret[0] != "dog" {
+			t.Error("Unexpected wildcard matches:", ret)
+		}
+		if ret := searcher.SearchWildcard("c?", '?'); len(ret) != 0 {
+			t.Error("Unexpected wildcard matches:", ret)
+		}
+	}
+}
+
+func TestSearchRunes(t *testing.T) {
+	searcher := NewBuilder().Add("犹豫就会败北", 1).Add("犹豫", 2).Build()
+	for _, word := range []string{"犹豫就会败北", "犹豫", "犹豫就", "败北"} {
+		ok, value := searcher.Search(word)
+		runesOK, runesValue := searcher.SearchRunes([]rune(word))
+		if ok != runesOK || value != runesValue {
+			t.Errorf("Mismatched results for '%v': (%v, %v) vs (%v, %v)",
+				word, ok, value, runesOK, runesValue)
+		}
+	}
+}
+
 func TestCover(t *testing.T) {
 	builder := NewBuilder()
 	words := []string{
@@ -85,6 +330,59 @@ func TestCover(t *testing.T) {
 	sort.StringSlice(values).Sort()
 }
 
+func TestCoverWithMetrics(t *testing.T) {
+	builder := NewBuilder()
+	words := []string{
+		"abash", "abashed", "unabashed",
+		"atomical", "atomically", "anatomical", "anatomically"}
+	for _, word := range words {
+		builder.Add(word, word)
+	}
+	searcher := builder.Build()
+	text := "unabashed x anatomically"
+	ret, m := searcher.CoverWithMetrics(text)
+	if len(ret) != len(words) {
+		t.Fatal("Fail to cover enough words:", ret)
+	}
+	if m.Transitions != len(text) {
+		t.Errorf("Unexpected %v transitions", m.Transitions)
+	}
+	if m.SuffixHops == 0 || m.TerminalChecks < len(words) || m.TerminalChecks > len(text)*2 {
+		t.Errorf("Implausible metrics %+v", m)
+	}
+}
+
+func FuzzCover(f *testing.F) {
+	words := []string{"he", "she", "his", "hers", "a", "\xff\xfe", "床前"}
+	var searchers []*Searcher
+	for _, builder := range []*Builder{NewBuilder(), NewBuilder().RemapAlphabet()} {
+		for _, word := range words {
+			builder.Add(word, word)
+		}
+		searchers = append(searchers, builder.Build())
+	}
+	for _, seed := range []string{"", "ushers", "a\x00a", "he\x00rs", "\xff\xfe\x00床前"} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		text := string(data)
+		for _, searcher := range searchers {
+			covered := make(map[interface{}]bool)
+			for _, val := range searcher.Cover(text) {
+				if covered[val] {
+					t.Errorf("Duplicated value %v", val)
+				}
+				covered[val] = true
+			}
+			for _, word := range words {
+				if covered[word] != strings.Contains(text, word) {
+					t.Errorf("Unexpected cover of '%v' in %q", word, text)
+				}
+			}
+		}
+	})
+}
+
 func TestCoverCN(t *testing.T) {
 	builder := NewBuilder()
 	words := []string{"床前", "月光", "明月", "地上", "霜", "是"}
@@ -102,3 +400,1205 @@ func TestCoverCN(t *testing.T) {
 	}
 	sort.StringSlice(values).Sort()
 }
+
+func TestCoverInto(t *testing.T) {
+	builder := NewBuilder()
+	words := []string{"床前", "月光", "明月", "地上", "霜", "是"}
+	for _, word := range words {
+		builder.Add(word, word)
+	}
+	searcher := builder.Build()
+	dst := []interface{}{"head"}
+	ret := searcher.CoverInto("床前明月光x，a疑是地上霜", dst)
+	if len(ret) != len(words)+1 || ret[0] != "head" {
+		t.Fatal("Fail to append covered words:", ret)
+	}
+}
+
+func TestBuildWithStats(t *testing.T) {
+	builder := NewBuilder()
+	words := lowercaseDictionary(1000)
+	for _, word := range words {
+		builder.AddWord(word)
+	}
+	searcher, stats := builder.BuildWithStats()
+	if stats.Extensions < 1 || stats.Collisions < 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if !searcher.Contains(words[0]) {
+		t.Error("Fail to find the first word")
+	}
+
+	_, stats = NewBuilder().Add("a", 1).BuildWithStats()
+	if stats.Extensions < 1 {
+		t.Errorf("Unexpected stats %+v for a single word", stats)
+	}
+}
+
+func TestSafeBuild(t *testing.T) {
+	searcher, err := NewBuilder().Add("hello", 1).SafeBuild()
+	if err != nil || searcher == nil {
+		t.Fatal("Unexpected build failure:", err)
+	}
+
+	searcher, err = NewBuilder().Add("hel\x00lo", 1).SafeBuild()
+	if err == nil || searcher != nil {
+		t.Fatal("Expect an error for word containing '\\0'")
+	}
+	if !strings.Contains(err.Error(), "Word contains") {
+		t.Errorf("Unexpected error message: %v", err)
+	}
+}
+
+func TestBuildFromChan(t *testing.T) {
+	type entry = struct {
+		Word  string
+		Value interface{}
+	}
+	ch := make(chan entry, 3)
+	ch <- entry{"hello", 1}
+	ch <- entry{"world", 2}
+	ch <- entry{"hi", 3}
+	close(ch)
+	searcher, err := BuildFromChan(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, word := range []string{"hello", "world", "hi"} {
+		if ok, value := searcher.Search(word); !ok || value != i+1 {
+			t.Errorf("Unexpected value %v for '%v'", value, word)
+		}
+	}
+
+	ch = make(chan entry, 2)
+	ch <- entry{"", 1}
+	ch <- entry{"hello", 2}
+	close(ch)
+	if _, err := BuildFromChan(ch); err == nil {
+		t.Error("Expect an error for an empty word")
+	}
+	if len(ch) != 0 {
+		t.Error("Expect the channel to be drained")
+	}
+}
+
+func TestCoverTimeout(t *testing.T) {
+	searcher := NewBuilder().Add("bad", "bad").Add("word", "word").AddWithMode("is", "is", WholeWord).Build()
+	text := "this is a bad word"
+	ret, ok := searcher.CoverTimeout(text, time.Minute)
+	if !ok {
+		t.Error("Unexpected timeout")
+	}
+	if expected := searcher.Cover(text); len(ret) != len(expected) {
+		t.Errorf("Unexpected values %v, want %v", ret, expected)
+	}
+
+	large := strings.Repeat("x", 1<<20) + "bad"
+	if ret, ok := searcher.CoverTimeout(large, time.Nanosecond); ok || len(ret) != 0 {
+		t.Error("Expect an incomplete scan:", ret)
+	}
+}
+
+func TestBuildFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dict.txt": &fstest.MapFile{Data: []byte("hello\n\n  world \nhi\n")},
+	}
+	searcher, err := BuildFromFS(fsys, "dict.txt", func(line string) interface{} {
+		return len(line)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, word := range []string{"hello", "world", "hi"} {
+		if ok, value := searcher.Search(word); !ok || value != len(word) {
+			t.Errorf("Unexpected value %v for '%v'", value, word)
+		}
+	}
+	if ret := searcher.Cover("hello world"); len(ret) != 2 {
+		t.Error("Fail to cover enough words:", ret)
+	}
+
+	if _, err := BuildFromFS(fsys, "missing.txt", nil); err == nil {
+		t.Error("Expect an error for a missing file")
+	}
+}
+
+func TestCoverWeighted(t *testing.T) {
+	builder := NewBuilder()
+	words := []string{"床前", "月光", "明月", "地上", "霜", "是"}
+	for _, word := range words {
+		builder.Add(word, word)
+	}
+	searcher := builder.Build()
+	weight := func(value interface{}, length int) float64 {
+		return float64(length)
+	}
+	// 床前, 明月 and 月光 are 6 bytes each
+	if sum := searcher.CoverWeighted("床前明月光", weight); sum != 18 {
+		t.Errorf("Unexpected weighted sum: %v", sum)
+	}
+	// occurrences rather than distinct words are counted
+	if sum := searcher.CoverWeighted("霜霜", weight); sum != 6 {
+		t.Errorf("Unexpected weighted sum: %v", sum)
+	}
+}
+
+func TestCoverScore(t *testing.T) {
+	searcher := NewBuilder().
+		AddWeighted("mild", "mild", 1).
+		AddWeighted("severe", "severe", 5).
+		Add("plain", "plain").
+		Build()
+	if score := searcher.CoverScore("mild, plain and severe, mild again"); score != 6 {
+		t.Errorf("Unexpected score %v", score)
+	}
+	searcher.Compact()
+	if score := searcher.CoverScore("severe"); score != 5 {
+		t.Errorf("Unexpected score %v after compaction", score)
+	}
+	if score := NewBuilder().Add("mild", "mild").Build().CoverScore("mild"); score != 0 {
+		t.Errorf("Unexpected score %v without weights", score)
+	}
+}
+
+func TestCoverByTag(t *testing.T) {
+	searcher := NewBuilder().
+		AddTagged("phone", "phone", "pii").
+		AddTagged("email", "email", "pii", "contact").
+		AddTagged("winner", "winner", "spam").
+		Add("plain", "plain").
+		Build()
+	text := "winner, send your email and phone, plain"
+	ret := searcher.CoverByTag(text, "pii")
+	if len(ret) != 2 || ret[0] != "email" || ret[1] != "phone" {
+		t.Error("Unexpected pii matches:", ret)
+	}
+	if ret := searcher.CoverByTag(text, "spam"); len(ret) != 1 || ret[0] != "winner" {
+		t.Error("Unexpected spam matches:", ret)
+	}
+	if ret := searcher.CoverByTag(text, "unknown"); len(ret) != 0 {
+		t.Error("Unexpected matches of an unknown tag:", ret)
+	}
+	searcher.Compact()
+	if ret := searcher.CoverByTag(text, "contact"); len(ret) != 1 || ret[0] != "email" {
+		t.Error("Unexpected contact matches after compaction:", ret)
+	}
+}
+
+func TestDiffCover(t *testing.T) {
+	a := NewBuilder().Add("bad", "bad").Add("word", "word").Add("ugly", "ugly").Build()
+	b := NewBuilder().Add("bad", "bad").Add("word", "word").Add("evil", "evil").Build()
+	onlyA, onlyB := DiffCover(a, b, "bad ugly evil word")
+	if len(onlyA) != 1 || onlyA[0] != "ugly" {
+		t.Error("Unexpected values only in a:", onlyA)
+	}
+	if len(onlyB) != 1 || onlyB[0] != "evil" {
+		t.Error("Unexpected values only in b:", onlyB)
+	}
+	if onlyA, onlyB := DiffCover(a, b, "bad word"); len(onlyA) != 0 || len(onlyB) != 0 {
+		t.Error("Unexpected differences:", onlyA, onlyB)
+	}
+}
+
+func TestAddPattern(t *testing.T) {
+	searcher := NewBuilder().AddPattern(`a\db`, "a-digit-b").AddPattern(`x\w\\`, "x-word").Build()
+	if ret := searcher.Cover("see a5b here"); len(ret) != 1 || ret[0] != "a-digit-b" {
+		t.Error("Fail to match the digit class:", ret)
+	}
+	if ret := searcher.Cover("aab x_\\"); len(ret) != 1 || ret[0] != "x-word" {
+		t.Error("Unexpected matches:", ret)
+	}
+	if ok, _ := searcher.Search("a0b"); !ok {
+		t.Error("Fail to find an expanded word")
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("Expect a panic for an unknown escape")
+			}
+		}()
+		NewBuilder().AddPattern(`a\q`, 1)
+	}()
+}
+
+func TestCoverBytesValues(t *testing.T) {
+	searcher := NewBuilder().AddBytes("x", []byte("y")).AddBytes("secret", []byte("***")).Add("plain", 1).Build()
+	ret := searcher.CoverBytesValues("a secret x, plain")
+	if len(ret) != 2 || string(ret[0]) != "***" || string(ret[1]) != "y" {
+		t.Errorf("Unexpected byte values %q", ret)
+	}
+	if ok, value := searcher.Search("x"); !ok || string(value.([]byte)) != "y" {
+		t.Errorf("Unexpected value %v for 'x'", value)
+	}
+	searcher.Compact()
+	if ret := searcher.CoverBytesValues("x"); len(ret) != 1 || string(ret[0]) != "y" {
+		t.Errorf("Unexpected byte values %q after compaction", ret)
+	}
+}
+
+func TestRemapAlphabet(t *testing.T) {
+	builder := NewBuilder().RemapAlphabet()
+	words := []string{
+		"abash", "abashed", "unabashed",
+		"atomical", "atomically", "anatomical", "anatomically", "床前"}
+	for _, word := range words {
+		builder.Add(word, word)
+	}
+	searcher := builder.Build()
+	for _, word := range words {
+		if ok, value := searcher.Search(word); !ok || value != word {
+			t.Errorf("Fail to match '%v'", word)
+		}
+	}
+	if searcher.PrefixSearch("abz") {
+		t.Error("Unexpected prefix match 'abz'")
+	}
+	ret := searcher.Cover("unabashed x anatomically 床前")
+	if len(ret) != len(words) {
+		t.Fatal("Fail to cover enough words:", ret)
+	}
+}
+
+func TestRemapAlphabetAdjacentLabels(t *testing.T) {
+	// '-' gets label 1, right next to '\0' of "黛博拉"
+	words := []string{"黛博拉", "黛博拉-罗维尔"}
+	builder := NewBuilder().RemapAlphabet()
+	for _, word := range words {
+		builder.Add(word, word)
+	}
+	searcher := builder.Build()
+	for _, word := range words {
+		if ok, value := searcher.Search(word); !ok || value != word {
+			t.Errorf("Fail to match '%v'", word)
+		}
+	}
+}
+
+func lowercaseDictionary(n int) []string {
+	seed := uint32(1)
+	words := make([]string, n)
+	for i := range words {
+		seed = seed*1103515245 + 12345
+		word := make([]byte, 3+seed%8)
+		for j := range word {
+			seed = seed*1103515245 + 12345
+			word[j] = 'a' + byte((seed>>16)%26)
+		}
+		words[i] = string(word)
+	}
+	return words
+}
+
+func BenchmarkRemapAlphabet(b *testing.B) {
+	words := lowercaseDictionary(5000)
+	for _, remap := range []bool{false, true} {
+		name := "plain"
+		if remap {
+			name = "remap"
+		}
+		b.Run(name, func(b *testing.B) {
+			var searcher *Searcher
+			for i := 0; i < b.N; i++ {
+				builder := NewBuilder()
+				if remap {
+					builder.RemapAlphabet()
+				}
+				for j, word := range words {
+					builder.Add(word, j)
+				}
+				searcher = builder.Build()
+			}
+			b.ReportMetric(float64(searcher.SizeBytes()), "size-bytes")
+		})
+	}
+}
+
+func TestWithBloom(t *testing.T) {
+	words := lowercaseDictionary(5000)
+	builder := NewBuilder().WithBloom()
+	for i, word := range words {
+		builder.Add(word, i)
+	}
+	searcher := builder.Build()
+	for _, word := range words {
+		if !searcher.Contains(word) {
+			t.Fatalf("Unexpected miss of '%v'", word)
+		}
+		if ok, _ := searcher.Search(word); !ok {
+			t.Fatalf("Unexpected miss of '%v'", word)
+		}
+		if searcher.Contains(word + "_") {
+			t.Fatalf("Unexpected match of '%v_'", word)
+		}
+	}
+
+	folded := NewBuilder().CaseInsensitive().WithBloom().Add("Hello", 1).Add("world", 2).Build()
+	for _, word := range []string{"hello", "HELLO", "World"} {
+		if !folded.Contains(word) {
+			t.Errorf("Unexpected miss of '%v'", word)
+		}
+	}
+	if folded.Contains("hell") {
+		t.Error("Unexpected match of 'hell'")
+	}
+}
+
+// BenchmarkSearchMiss looks up words with their last byte replaced, over a
+// dictionary large enough for the trie walks to miss the cache.
+func BenchmarkSearchMiss(b *testing.B) {
+	words := lowercaseDictionary(200000)
+	misses := make([]string, len(words))
+	for i, word := range words {
+		misses[i] = word[:len(word)-1] + "_"
+	}
+	for _, bloom := range []bool{false, true} {
+		name := "plain"
+		if bloom {
+			name = "bloom"
+		}
+		builder := NewBuilder()
+		if bloom {
+			builder.WithBloom()
+		}
+		for j, word := range words {
+			builder.Add(word, j)
+		}
+		searcher := builder.Build()
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				searcher.Contains(misses[i%len(misses)])
+			}
+		})
+	}
+}
+
+func TestCoverTyped(t *testing.T) {
+	searcher := NewBuilder().Add("one", 1).Add("two", "2").Add("three", 3).Build()
+	ret := CoverTyped[int](searcher, "one two three")
+	if len(ret) != 2 || ret[0] != 1 || ret[1] != 3 {
+		t.Error("Unexpected int values:", ret)
+	}
+	if ret := CoverTyped[float64](searcher, "one two three"); len(ret) != 0 {
+		t.Error("Unexpected float64 values:", ret)
+	}
+}
+
+func TestCoverMany(t *testing.T) {
+	searcher := NewBuilder().Add("bad", "bad").Add("word", "word").Add("ugly", "ugly").Build()
+	ret := searcher.CoverMany([]string{"a bad word", "ugly word"})
+	if len(ret) != 3 || ret[0] != "bad" || ret[1] != "word" || ret[2] != "ugly" {
+		t.Error("Unexpected union:", ret)
+	}
+	if ret := searcher.CoverMany(nil); len(ret) != 0 {
+		t.Error("Unexpected values without texts:", ret)
+	}
+}
+
+func TestCoverMaxPerPos(t *testing.T) {
+	searcher := NewBuilder().Add("a", "a").Add("aa", "aa").Add("aaa", "aaa").Build()
+	ret := searcher.CoverMaxPerPos("aaaa", 1)
+	if len(ret) != 3 || ret[0] != "a" || ret[1] != "aa" || ret[2] != "aaa" {
+		t.Error("Unexpected covered words:", ret)
+	}
+	ret = searcher.CoverMaxPerPos("baab", 2)
+	if len(ret) != 2 || ret[0] != "a" || ret[1] != "aa" {
+		t.Error("Unexpected covered words:", ret)
+	}
+	if ret := searcher.CoverMaxPerPos("aaaa", 0); len(ret) != 0 {
+		t.Error("Unexpected covered words:", ret)
+	}
+}
+
+func TestUnusedWords(t *testing.T) {
+	searcher := NewBuilder().Add("bad", "bad").Add("word", "word").Add("ugly", "ugly").Build()
+	ret := searcher.UnusedWords([]string{"a bad word", "bad words"})
+	if len(ret) != 1 || ret[0] != "ugly" {
+		t.Error("Unexpected unused words:", ret)
+	}
+	if ret := searcher.UnusedWords(nil); len(ret) != 3 {
+		t.Error("Unexpected unused words without texts:", ret)
+	}
+}
+
+func TestCoverMinLen(t *testing.T) {
+	searcher := NewBuilder().Add("a", "a").Add("abc", "abc").Build()
+	ret := searcher.CoverMinLen("xabcx", 2)
+	if len(ret) != 1 || ret[0] != "abc" {
+		t.Fatal("Unexpected covered words:", ret)
+	}
+	if ret := searcher.CoverMinLen("xabcx", 1); len(ret) != 2 {
+		t.Fatal("Unexpected covered words:", ret)
+	}
+}
+
+func TestCoverFiltered(t *testing.T) {
+	builder := NewBuilder()
+	words := []string{"one", "two", "three", "four", "five"}
+	for i, word := range words {
+		builder.Add(word, i+1)
+	}
+	searcher := builder.Build()
+	even := func(value interface{}) bool {
+		return value.(int)%2 == 0
+	}
+	ret := searcher.CoverFiltered("one two three four five", even)
+	if len(ret) != 2 || ret[0] != 2 || ret[1] != 4 {
+		t.Error("Unexpected filtered values:", ret)
+	}
+}
+
+func TestIsClean(t *testing.T) {
+	searcher := NewBuilder().Add("bad", 1).Add("word", 2).Build()
+	if !searcher.IsClean("a clean text") {
+		t.Error("Expect clean text")
+	}
+	if searcher.IsClean("a bad text") {
+		t.Error("Expect dirty text")
+	}
+}
+
+func TestHasAtLeast(t *testing.T) {
+	searcher := NewBuilder().Add("cheap", 1).Add("pills", 2).Add("winner", 3).Build()
+	if !searcher.HasAtLeast("cheap pills, cheap", 2) {
+		t.Error("Expect two distinct words")
+	}
+	if searcher.HasAtLeast("cheap cheap cheap", 2) {
+		t.Error("Unexpected two distinct words of one repeated")
+	}
+	if !searcher.HasAtLeast("nothing", 0) {
+		t.Error("Expect any text to have at least 0 words")
+	}
+}
+
+func TestContainsValue(t *testing.T) {
+	searcher := NewBuilder().Add("bad", "bad").Add("word", "word").Add("evil", 3).Build()
+	text := strings.Repeat("a bad word ", 1000) + "evil"
+	if !searcher.ContainsValue(text, 3) {
+		t.Error("Fail to find the target near the end")
+	}
+	if searcher.ContainsValue(text, "ugly") {
+		t.Error("Unexpected target found")
+	}
+}
+
+func TestAddWithMode(t *testing.T) {
+	searcher := NewBuilder().
+		AddWithMode("cat", "cat", WholeWord).
+		AddWithMode("dog", "dog", Substring).
+		Build()
+	if ret := searcher.Cover("category doghouse"); len(ret) != 1 || ret[0] != "dog" {
+		t.Error("Unexpected covered words:", ret)
+	}
+	if ret := searcher.Cover("category, cat!"); len(ret) != 1 || ret[0] != "cat" {
+		t.Error("Unexpected covered words:", ret)
+	}
+	if ret := searcher.CoverWithPositions("category cat"); len(ret) != 1 || ret[0].Start != 9 {
+		t.Error("Unexpected matches:", ret)
+	}
+}
+
+func TestHasSuffixLinks(t *testing.T) {
+	searcher := NewBuilder().Add("hello", 1).Add("world", 2).Build()
+	if searcher.HasSuffixLinks() {
+		t.Error("Unexpected suffix links for disjoint words")
+	}
+	if ret := searcher.Cover("hello world, hell"); len(ret) != 2 {
+		t.Error("Fail to cover enough words:", ret)
+	}
+
+	searcher = NewBuilder().Add("abash", 1).Add("unabashed", 2).Build()
+	if !searcher.HasSuffixLinks() {
+		t.Error("Expect suffix links for overlapped words")
+	}
+	if ret := searcher.Cover("unabashed"); len(ret) != 2 {
+		t.Error("Fail to cover enough words:", ret)
+	}
+}
+
+func TestRejectSubstrings(t *testing.T) {
+	searcher, err := NewBuilder().RejectSubstrings().
+		Add("cat", 1).Add("category", 2).Add("dog", 3).BuildE()
+	if err == nil || searcher != nil {
+		t.Fatal("Expect an error for substring words")
+	}
+	if !errors.Is(err, ErrSubstringWords) || !strings.Contains(err.Error(), `"cat" in "category"`) {
+		t.Errorf("Unexpected error message: %v", err)
+	}
+
+	searcher, err = NewBuilder().RejectSubstrings().
+		Add("cat", 1).Add("dog", 3).BuildE()
+	if err != nil || searcher == nil {
+		t.Fatal("Unexpected build failure:", err)
+	}
+}
+
+func TestRequireValidUTF8(t *testing.T) {
+	_, err := NewBuilder().RequireValidUTF8().Add("床前", 1).Add("bad\xffword", 2).Add("\xe5\xba", 3).BuildE()
+	if !errors.Is(err, ErrInvalidUTF8) {
+		t.Fatal("Expect ErrInvalidUTF8, got", err)
+	}
+	if !strings.Contains(err.Error(), `"bad\xffword"`) || strings.Contains(err.Error(), "床前") {
+		t.Error("Unexpected offenders listed:", err)
+	}
+	if _, err := NewBuilder().RequireValidUTF8().ReverseMatch().Add("床前", 1).BuildE(); err != nil {
+		t.Error("Unexpected error for valid words:", err)
+	}
+}
+
+func TestMaxArrayLen(t *testing.T) {
+	builder := NewBuilder().MaxArrayLen(2 * blockSize)
+	for i, word := range lowercaseDictionary(1000) {
+		builder.Add(word, i)
+	}
+	searcher, err := builder.BuildE()
+	if err != ErrSizeBudgetExceeded || searcher != nil {
+		t.Fatal("Expect ErrSizeBudgetExceeded, got", err)
+	}
+
+	searcher, err = NewBuilder().MaxArrayLen(2*blockSize).Add("hello", 1).BuildE()
+	if err != nil || searcher == nil {
+		t.Fatal("Unexpected build failure:", err)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	var logged []string
+	logf := func(format string, args ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}
+	NewBuilder().Logger(logf).Add("x", 1).Add("x", 2).Build()
+	if len(logged) == 0 {
+		t.Fatal("Expect the duplicate to be logged without Dedup")
+	}
+
+	logged = nil
+	searcher := NewBuilder().Logger(logf).Dedup().Add("x", 1).Add("x", 2).Add("x", 3).Build()
+	if len(logged) > 0 {
+		t.Error("Unexpected log output:", logged)
+	}
+	if ok, value := searcher.Search("x"); !ok || value != 1 {
+		t.Errorf("Unexpected value %v for 'x'", value)
+	}
+	if ret := searcher.Cover("xx"); len(ret) != 1 {
+		t.Error("Unexpected covered words:", ret)
+	}
+}
+
+func TestStats(t *testing.T) {
+	builder := NewBuilder()
+	words := []string{"床前", "月光", "明月", "地上", "霜", "是"}
+	prefixes := make(map[string]struct{})
+	for _, word := range words {
+		builder.Add(word, word)
+		for i := 0; i <= len(word); i++ {
+			prefixes[word[:i]] = struct{}{}
+		}
+	}
+	stats := builder.Build().Stats()
+	if stats.States != len(prefixes) {
+		t.Errorf("Unexpected states %v, want %v", stats.States, len(prefixes))
+	}
+	if stats.Terminals != len(words) {
+		t.Errorf("Unexpected terminals %v, want %v", stats.Terminals, len(words))
+	}
+	if stats.SuffixLinks <= 0 || stats.SuffixLinks >= stats.States {
+		t.Errorf("Unexpected suffix links %v", stats.SuffixLinks)
+	}
+	if stats.ArrayLen%blockSize != 0 || stats.ArrayLen < stats.States+stats.Terminals {
+		t.Errorf("Unexpected array length %v", stats.ArrayLen)
+	}
+	used := float64(stats.States+stats.Terminals) / float64(stats.ArrayLen)
+	if stats.LoadFactor != used {
+		t.Errorf("Unexpected load factor %v, want %v", stats.LoadFactor, used)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var logs []string
+	logf := func(format string, args ...interface{}) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}
+	NewBuilder().Logger(logf).Add("x", 1).Add("x", 2).Add("y", 3).Build()
+	if len(logs) != 1 || !strings.Contains(logs[0], "x") {
+		t.Error("Unexpected logs:", logs)
+	}
+}
+
+func TestOnState(t *testing.T) {
+	states, terminals := 0, 0
+	depths := make(map[int]int)
+	words := []string{"he", "hers", "his", "she"}
+	builder := NewBuilder().OnState(func(state, depth int, terminal bool) {
+		states++
+		depths[state] = depth
+		if terminal {
+			terminals++
+		}
+	})
+	for _, word := range words {
+		builder.Add(word, word)
+	}
+	searcher := builder.Build()
+	if stats := searcher.Stats(); states != stats.States || terminals != len(words) {
+		t.Errorf("Unexpected %v states and %v terminals", states, terminals)
+	}
+	for state, depth := range depths {
+		if depth != searcher.depth(state) {
+			t.Errorf("Unexpected depth %v of state %v", depth, state)
+		}
+	}
+}
+
+func TestEstimateSize(t *testing.T) {
+	builder := NewBuilder()
+	for i, word := range lowercaseDictionary(5000) {
+		builder.Add(word, i)
+	}
+	estimate := builder.EstimateSize()
+	actual := builder.Build().SizeBytes()
+	if estimate > actual || float64(estimate) < float64(actual)*0.5 {
+		t.Errorf("Estimate %v too far from actual %v", estimate, actual)
+	}
+
+	// reversed words share suffixes rather than prefixes
+	builder = NewBuilder().ReverseMatch()
+	for i, word := range lowercaseDictionary(5000) {
+		builder.Add(word+"-with-a-long-shared-suffix", i)
+	}
+	estimate = builder.EstimateSize()
+	actual = builder.Build().SizeBytes()
+	if estimate > actual || float64(estimate) < float64(actual)*0.5 {
+		t.Errorf("Estimate %v too far from actual %v with ReverseMatch", estimate, actual)
+	}
+}
+
+func TestCoverCapped(t *testing.T) {
+	searcher := NewBuilder().Add("spam", "spam").Add("ham", "ham").Build()
+	ret := searcher.CoverCapped("spam spam ham spam spam spam", 2)
+	if len(ret) != 2 || ret["spam"] != 2 || ret["ham"] != 1 {
+		t.Error("Unexpected counts:", ret)
+	}
+}
+
+func TestCoverAccumulate(t *testing.T) {
+	searcher := NewBuilder().Add("spam", "spam").Add("ham", "ham").Add("eggs", "eggs").Build()
+	var stats CoverStats
+	texts := []string{"spam spam ham", "eggs and spam", "nothing here"}
+	for _, text := range texts {
+		searcher.CoverAccumulate(text, &stats)
+	}
+	if len(stats.Counts) != 3 || stats.Counts["spam"] != 3 || stats.Counts["ham"] != 1 || stats.Counts["eggs"] != 1 {
+		t.Error("Unexpected counts:", stats.Counts)
+	}
+	if stats.Texts != 3 || stats.Bytes != int64(len(texts[0])+len(texts[1])+len(texts[2])) {
+		t.Error("Unexpected totals:", stats.Texts, stats.Bytes)
+	}
+}
+
+func TestUnsortedAfterSort(t *testing.T) {
+	if err := checkSorted([]string{"b", "abd", "abc"}); !errors.Is(err, ErrUnsortedAfterSort) {
+		t.Error("Expect ErrUnsortedAfterSort, got", err)
+	}
+	if err := checkSorted([]string{"abc", "abc", "abd", "b"}); err != nil {
+		t.Error("Unexpected error for sorted words:", err)
+	}
+
+	// the words Build sorts always pass, reversed or not
+	for _, builder := range []*Builder{NewBuilder(), NewBuilder().ReverseMatch()} {
+		searcher, err := builder.Add("b", 3).Add("abd", 2).Add("abc", 1).BuildE()
+		if err != nil || searcher == nil {
+			t.Fatal("Unexpected error:", err)
+		}
+	}
+}
+
+func TestBuilderConsumed(t *testing.T) {
+	builder := NewBuilder().Add("hello", 1)
+	searcher := builder.Build()
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("Expect a panic adding to a consumed builder")
+			}
+		}()
+		builder.Add("world", 2)
+	}()
+	if _, err := builder.SafeBuild(); err == nil || !strings.Contains(err.Error(), "consumed") {
+		t.Error("Expect an error building a consumed builder, got", err)
+	}
+	if ok, value := searcher.Search("hello"); !ok || value != 1 {
+		t.Error("Searcher broken after misusing its builder")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	// composes "e" and a combining acute accent only, enough for the test
+	nfc := func(s string) string {
+		return strings.Replace(s, "e\u0301", "\u00e9", -1)
+	}
+	searcher := NewBuilder().Normalize(nfc).Add("caf\u00e9", "cafe").Build()
+	decomposed := "caf" + "e\u0301"
+	if ok, value := searcher.Search(decomposed); !ok || value != "cafe" {
+		t.Error("Fail to match decomposed input")
+	}
+	if ret := searcher.Cover("un " + decomposed + " noir"); len(ret) != 1 || ret[0] != "cafe" {
+		t.Error("Fail to cover decomposed input:", ret)
+	}
+	if ret := searcher.CoverWithPositions(decomposed); len(ret) != 1 {
+		t.Error("Fail to match decomposed input:", ret)
+	}
+}
+
+func TestLengthHistogram(t *testing.T) {
+	searcher := NewBuilder().Add("a", 1).Add("bb", 2).Add("cc", 3).Add("ddd", 4).Add("cc", 5).Build()
+	hist := searcher.LengthHistogram()
+	if len(hist) != 3 || hist[1] != 1 || hist[2] != 2 || hist[3] != 1 {
+		t.Error("Unexpected histogram:", hist)
+	}
+}
+
+func TestTerminalStates(t *testing.T) {
+	builder := NewBuilder()
+	words := []string{"床前", "月光", "明月", "地上", "霜", "是"}
+	for _, word := range words {
+		builder.Add(word, word)
+	}
+	builder.Add("霜", "dup")
+	searcher := builder.Build()
+	states := searcher.TerminalStates()
+	if len(states) != len(words) {
+		t.Fatal("Unexpected terminal states:", states)
+	}
+	for _, state := range states {
+		if !searcher.IsTerminal(state) {
+			t.Errorf("Unexpected non-terminal state %v", state)
+		}
+	}
+}
+
+func TestIsEmpty(t *testing.T) {
+	searcher := NewBuilder().Build()
+	if !searcher.IsEmpty() {
+		t.Error("Expected an empty searcher")
+	}
+	if err := searcher.Validate(); err != nil {
+		t.Error("Unexpected invalid empty searcher:", err)
+	}
+	if matches := searcher.Cover("床前明月光"); len(matches) != 0 {
+		t.Error("Unexpected matches:", matches)
+	}
+	if searcher.Contains("") || searcher.Contains("床前") {
+		t.Error("Unexpected word in the empty searcher")
+	}
+
+	builder := NewBuilder()
+	builder.Add("床前", 1)
+	if builder.Build().IsEmpty() {
+		t.Error("Unexpected empty searcher")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	builder := NewBuilder()
+	for i, word := range []string{"床前", "月光", "明月", "地上", "霜", "是"} {
+		builder.Add(word, i%2 == 0)
+	}
+	searcher := builder.Build()
+	if err := searcher.Validate(); err != nil {
+		t.Error("Unexpected error for a fresh searcher:", err)
+	}
+	searcher.Compact()
+	if err := searcher.Validate(); err != nil {
+		t.Error("Unexpected error after compaction:", err)
+	}
+	searcher.values = searcher.values[:1]
+	if err := searcher.Validate(); err == nil {
+		t.Error("Expect an error for value indexes out of range")
+	}
+
+	searcher = NewBuilder().RemapAlphabet().Add("hello", 1).Add("world", 2).Build()
+	if err := searcher.Validate(); err != nil {
+		t.Error("Unexpected error for a remapped searcher:", err)
+	}
+
+	for _, c := range []struct {
+		name        string
+		base, check []int
+	}{
+		// states 5 and 6 are each other's parent, and 4 is the terminal of 5
+		{"cycle of parents", []int{0, 0, 0, 0, 0, 4, 3}, []int{-1, -1, -1, -1, 5, 6, 5}},
+		{"negative base of a leaf", []int{0, -10}, []int{-1, 0}},
+		{"negative base of root", []int{-1, 0}, []int{-1, -1}},
+		{"no root", []int{}, []int{}},
+	} {
+		corrupt := &Searcher{base: c.base, check: c.check, suffixLink: make([]int, len(c.base)), values: []interface{}{nil, 1}}
+		if err := corrupt.Validate(); err == nil {
+			t.Errorf("Expect an error for %v", c.name)
+		}
+		if _, err := NewSearcherComputingLinks(c.base, c.check, []interface{}{nil, 1}); err == nil {
+			t.Errorf("Expect an error for %v", c.name)
+		}
+	}
+}
+
+func TestNewSearcherFromArrays(t *testing.T) {
+	builder := NewBuilder()
+	words := []string{"床前", "月光", "明月", "地上", "霜", "是"}
+	for _, word := range words {
+		builder.Add(word, word)
+	}
+	searcher := builder.Build()
+	base, check, suffixLink := searcher.Arrays()
+	restored, err := NewSearcherFromArrays(base, check, suffixLink, searcher.values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !restored.Equal(searcher) {
+		t.Error("Expect the restored searcher to be equal")
+	}
+	if restored.MaxWordLen() != searcher.MaxWordLen() || restored.HasSuffixLinks() != searcher.HasSuffixLinks() {
+		t.Error("Unexpected metadata of the restored searcher")
+	}
+	if ret := restored.Cover("床前明月光x，a疑是地上霜"); len(ret) != len(words) {
+		t.Error("Fail to cover enough words:", ret)
+	}
+
+	base[0]++
+	if searcher.base[0] == base[0] {
+		t.Error("Expect Arrays to return copies")
+	}
+	if _, err := NewSearcherFromArrays(base, check, suffixLink[:1], searcher.values); err == nil {
+		t.Error("Expect an error for inconsistent arrays")
+	}
+
+	// a childless state with a negative base used to panic on Search
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				t.Error("Unexpected panic:", r)
+			}
+		}()
+		restored, err := NewSearcherFromArrays([]int{0, -10}, []int{-1, 0}, []int{0, 0}, []interface{}{nil})
+		if err == nil {
+			t.Error("Expect an error for a negative base")
+			restored.Search("\x01")
+		}
+	}()
+}
+
+func TestNewSearcherComputingLinks(t *testing.T) {
+	builder := NewBuilder()
+	words := []string{"he", "she", "his", "hers", "床前", "前明", "明月", "月光"}
+	for _, word := range words {
+		builder.Add(word, word)
+	}
+	searcher := builder.Build()
+	base, check, _ := searcher.Arrays()
+	restored, err := NewSearcherComputingLinks(base, check, searcher.values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !restored.Equal(searcher) {
+		t.Error("Expect the computed links to be equal to the built ones")
+	}
+	if restored.MaxWordLen() != searcher.MaxWordLen() || restored.HasSuffixLinks() != searcher.HasSuffixLinks() {
+		t.Error("Unexpected metadata of the restored searcher")
+	}
+	if ret := restored.Cover("ushers 床前明月光"); len(ret) != 7 {
+		t.Error("Fail to cover enough words:", ret)
+	}
+
+	if _, err := NewSearcherComputingLinks(base, check[:1], searcher.values); err == nil {
+		t.Error("Expect an error for inconsistent arrays")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	builder := NewBuilder()
+	words := []string{"床前", "月光", "明月", "地上", "霜", "是"}
+	for i, word := range words {
+		builder.Add(word, i%2 == 0)
+	}
+	searcher := builder.Build()
+	searcher.Compact()
+	if len(searcher.values) != 2 {
+		t.Errorf("Unexpected %v values after compaction", len(searcher.values))
+	}
+	for i, word := range words {
+		if ok, value := searcher.Search(word); !ok || value != (i%2 == 0) {
+			t.Errorf("Unexpected value %v for '%v'", value, word)
+		}
+	}
+	if ret := searcher.Cover("床前明月光x，a疑是地上霜"); len(ret) != len(words) {
+		t.Error("Fail to cover enough words:", ret)
+	}
+
+	// a comparable type may hold an uncomparable value
+	type holder struct{ X interface{} }
+	searcher = NewBuilder().Add("a", holder{[]int{1}}).Add("b", holder{[]int{1}}).Add("c", holder{1}).Add("d", holder{1}).Build()
+	searcher.Compact()
+	if len(searcher.values) != 3 {
+		t.Errorf("Unexpected %v values after compaction", len(searcher.values))
+	}
+	if ok, value := searcher.Search("b"); !ok || value.(holder).X.([]int)[0] != 1 {
+		t.Errorf("Unexpected value %v for 'b'", value)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	build := func() *Searcher {
+		builder := NewBuilder()
+		for i, word := range []string{"床前", "月光", "明月", "地上", "霜", "是"} {
+			builder.Add(word, i%2 == 0)
+		}
+		return builder.Build()
+	}
+	a, b := build(), build()
+	if !a.Equal(b) {
+		t.Error("Expect searchers of the same words to be equal")
+	}
+	b.Compact()
+	if a.Equal(b) {
+		t.Error("Unexpected equality after compaction")
+	}
+	if a.Equal(NewBuilder().Add("霜", true).Build()) {
+		t.Error("Unexpected equality of different words")
+	}
+}
+
+func TestEscapeNull(t *testing.T) {
+	searcher := NewBuilder().EscapeNull().Add("a\x00b", 1).Add("\x00", 2).Add("ab", 3).Build()
+	if ok, value := searcher.Search("a\x00b"); !ok || value != 1 {
+		t.Errorf("Unexpected value %v for 'a\\x00b'", value)
+	}
+	ret := searcher.CoverWithPositions("xx a\x00b ab")
+	if len(ret) != 3 || ret[0].Value != 2 || ret[1].Value != 1 || ret[1].Start != 3 || ret[2].Value != 3 {
+		t.Error("Unexpected matches:", ret)
+	}
+	if err := searcher.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	if _, err := NewBuilder().EscapeNull().Add(string(all), 1).SafeBuild(); err == nil {
+		t.Error("Expect an error for 256 distinct bytes")
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	searcher := NewBuilder().MaxDepth(3).Add("hello", "hello").Add("help", "help").Add("hi", "hi").Build()
+	if ok, value := searcher.Search("hel"); !ok || value != "hello" {
+		t.Errorf("Unexpected value %v for 'hel'", value)
+	}
+	if ok, _ := searcher.Search("hello"); ok {
+		t.Error("Unexpected match beyond the max depth")
+	}
+	if ok, value := searcher.Search("hi"); !ok || value != "hi" {
+		t.Errorf("Unexpected value %v for 'hi'", value)
+	}
+
+	// "犹" is 3 bytes, so 4 bytes keep only it
+	searcher = NewBuilder().MaxDepth(4).RuneSafe().Add("犹豫", 1).Build()
+	if ok, _ := searcher.Search("犹"); !ok {
+		t.Error("Fail to match the rune-safe prefix")
+	}
+
+	// a first character longer than the max depth is kept whole
+	searcher = NewBuilder().MaxDepth(2).RuneSafe().Add("床前", 1).MaxDepth(1).Add("été", 2).Build()
+	if ok, value := searcher.Search("床"); !ok || value != 1 {
+		t.Errorf("Unexpected value %v for '床'", value)
+	}
+	if ok, value := searcher.Search("é"); !ok || value != 2 {
+		t.Errorf("Unexpected value %v for 'é'", value)
+	}
+}
+
+func TestWarm(t *testing.T) {
+	searcher := NewBuilder().Add("hello", "hello").Add("world", "world").Build()
+	searcher.Warm()
+	if ok, value := searcher.Search("hello"); !ok || value != "hello" {
+		t.Error("Fail to match 'hello' after warming")
+	}
+	if ret := searcher.Cover("hello world"); len(ret) != 2 {
+		t.Error("Fail to cover enough words:", ret)
+	}
+
+	// concurrent calls must not race, e.g. under -race
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			searcher.Warm()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCoverWithScratch(t *testing.T) {
+	searcher := NewBuilder().Add("bad", "bad").Add("word", "word").Build()
+	seen := make(map[int]struct{})
+	for _, text := range []string{"bad word", "bad word", "word"} {
+		expected := searcher.Cover(text)
+		ret := searcher.CoverWithScratch(text, seen)
+		if len(ret) != len(expected) {
+			t.Errorf("Unexpected covered words %v, want %v", ret, expected)
+		}
+	}
+}
+
+func benchmarkDocuments() (*Searcher, []string) {
+	builder := NewBuilder()
+	words := []string{"床前", "月光", "明月", "地上", "霜", "是"}
+	for _, word := range words {
+		builder.Add(word, word)
+	}
+	docs := make([]string, 10000)
+	for i := range docs {
+		docs[i] = "床前明月光x，a疑是地上霜"
+	}
+	return builder.Build(), docs
+}
+
+func BenchmarkCover(b *testing.B) {
+	searcher, docs := benchmarkDocuments()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, doc := range docs {
+			searcher.Cover(doc)
+		}
+	}
+}
+
+func BenchmarkCoverInto(b *testing.B) {
+	searcher, docs := benchmarkDocuments()
+	var dst []interface{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, doc := range docs {
+			dst = searcher.CoverInto(doc, dst[:0])
+		}
+	}
+}
+
+// coverNoDedup is like Cover but keeps a value for every occurrence instead
+// of tracking the visited states.
+func coverNoDedup(s *Searcher, text string) []interface{} {
+	ret := make([]interface{}, 0)
+	state := 0
+	for i := 0; i < len(text); i++ {
+		state = s.step(state, text[i])
+		for checkState := state; checkState != 0; checkState = s.suffixLink[checkState] {
+			if index, ok := s.isTerminal(checkState); ok {
+				if val := s.values[index]; val != nil {
+					ret = append(ret, val)
+				}
+			}
+		}
+	}
+	return ret
+}
+
+func TestCoverNoDedup(t *testing.T) {
+	searcher, _ := benchmarkDocuments()
+	text := strings.Repeat("床前明月光x，a疑是地上霜", 3)
+	all := make(map[interface{}]int)
+	for _, val := range coverNoDedup(searcher, text) {
+		all[val]++
+	}
+	ret := searcher.Cover(text)
+	for _, val := range ret {
+		if all[val] != 3 {
+			t.Errorf("Unexpected %v occurrences of %v", all[val], val)
+		}
+	}
+	if len(ret) != len(all) {
+		t.Errorf("Unexpected values %v, want %v", ret, all)
+	}
+}
+
+func BenchmarkCoverNoDedup(b *testing.B) {
+	searcher, _ := benchmarkDocuments()
+	text := strings.Repeat("床前明月光x，a疑是地上霜", 10000)
+	b.Run("dedup", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			searcher.Cover(text)
+		}
+	})
+	b.Run("nodedup", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			coverNoDedup(searcher, text)
+		}
+	})
+}
+
+func BenchmarkCoverDisjoint(b *testing.B) {
+	// upper-case letters only lead the words, so no suffix is a prefix
+	builder := NewBuilder()
+	var text []byte
+	for i, word := range lowercaseDictionary(2000) {
+		word = string('A'+byte(i%26)) + word
+		builder.Add(word, i)
+		text = append(append(text, word...), ' ')
+	}
+	searcher := builder.Build()
+	if searcher.HasSuffixLinks() {
+		b.Fatal("Unexpected suffix links")
+	}
+	doc := string(text)
+	// the same automaton walked along the suffix links, for comparison
+	walked := *searcher
+	walked.hasSuffixLinks = true
+	for _, c := range []struct {
+		name     string
+		searcher *Searcher
+	}{{"plain", searcher}, {"links", &walked}} {
+		b.Run(c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				c.searcher.Cover(doc)
+			}
+		})
+	}
+}
+
+func BenchmarkIsClean(b *testing.B) {
+	searcher, docs := benchmarkDocuments()
+	b.Run("IsClean", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, doc := range docs {
+				searcher.IsClean(doc)
+			}
+		}
+	})
+	b.Run("Cover", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, doc := range docs {
+				_ = len(searcher.Cover(doc)) == 0
+			}
+		}
+	})
+}
+
+func BenchmarkCoverWithScratch(b *testing.B) {
+	searcher, docs := benchmarkDocuments()
+	seen := make(map[int]struct{})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, doc := range docs {
+			searcher.CoverWithScratch(doc, seen)
+		}
+	}
+}
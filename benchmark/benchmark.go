@@ -1,10 +1,8 @@
 package main
 
 import (
-	"bufio"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
 	"runtime"
@@ -16,6 +14,7 @@ import (
 	_ "net/http/pprof"
 
 	ac "github.com/codefever/ahocorasick"
+	"github.com/codefever/ahocorasick/acbench"
 )
 
 // flags
@@ -24,7 +23,7 @@ var (
 	flagText        = flag.String("text", "./cn/text.txt", "Path for text")
 	flagCPUProfile  = flag.String("cpuprofile", "", "write cpu profile to `file`")
 	flagMemProfile  = flag.String("memprofile", "", "write memory profile to `file`")
-	flagRunnerType  = flag.String("runner", "AC", "Runner type: AC/Dummy")
+	flagRunnerType  = flag.String("runner", "AC", "Runner type: AC/Dummy/Stream")
 	flagPrintResult = flag.Bool("printResult", false, "Print result line by line")
 )
 
@@ -54,6 +53,22 @@ func (r *acRunner) Name() string {
 	return "AC"
 }
 
+type streamRunner struct {
+	acRunner
+}
+
+func (r *streamRunner) Run(text string) []interface{} {
+	ret, err := r.searcher.CoverReader(strings.NewReader(text))
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+func (r *streamRunner) Name() string {
+	return "Stream"
+}
+
 type dummyRunner struct {
 	dict []string
 }
@@ -76,55 +91,13 @@ func (r *dummyRunner) Name() string {
 	return "Dummy"
 }
 
-func getMemAlloc() uint64 {
-	mem := new(runtime.MemStats)
-	runtime.GC()
-	runtime.ReadMemStats(mem)
-	return mem.HeapAlloc
-}
-
-func readDict(filePath string) ([]string, error) {
-	fp, err := os.OpenFile(filePath, os.O_RDONLY, 0644)
-	if err != nil {
-		return nil, err
-	}
-	defer fp.Close()
-
-	ret := make([]string, 0)
-	scanner := bufio.NewScanner(fp)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if len(line) > 0 {
-			ret = append(ret, line)
-		}
-	}
-	if err := scanner.Err(); err != nil {
-		return nil, err
-	}
-	return ret, nil
-}
-
-func readText(filePath string) (string, error) {
-	fp, err := os.OpenFile(filePath, os.O_RDONLY, 0644)
-	if err != nil {
-		return "", err
-	}
-	defer fp.Close()
-
-	bytes, err := ioutil.ReadAll(fp)
-	if err != nil {
-		return "", err
-	}
-	return string(bytes), nil
-}
-
 func runTest(r testRunner, dict []string, text string) []interface{} {
 	// init
-	memBefore := getMemAlloc()
+	memBefore := acbench.HeapAlloc()
 	timeBefore := time.Now()
 	r.Init(dict)
 	buildTimeCost := time.Since(timeBefore)
-	memAfter := getMemAlloc()
+	memAfter := acbench.HeapAlloc()
 	fmt.Printf("Build[%v]: mem=%v timecost=%v\n", r.Name(), memAfter-memBefore, buildTimeCost)
 
 	// run
@@ -139,12 +112,12 @@ func runTest(r testRunner, dict []string, text string) []interface{} {
 func main() {
 	flag.Parse()
 
-	dict, err := readDict(*flagDict)
+	dict, err := acbench.LoadDict(*flagDict)
 	if err != nil {
 		panic(err)
 	}
 
-	text, err := readText(*flagText)
+	text, err := acbench.LoadText(*flagText)
 	if err != nil {
 		panic(err)
 	}
@@ -155,6 +128,8 @@ func main() {
 		r = &acRunner{}
 	} else if *flagRunnerType == "Dummy" {
 		r = &dummyRunner{}
+	} else if *flagRunnerType == "Stream" {
+		r = &streamRunner{}
 	} else {
 		panic("What runner type?")
 	}
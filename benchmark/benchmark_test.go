@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestStreamRunner(t *testing.T) {
+	dict := []string{"床前", "月光", "明月", "地上", "霜", "是"}
+	text := "床前明月光x，a疑是地上霜"
+	ac := &acRunner{}
+	ac.Init(dict)
+	stream := &streamRunner{}
+	stream.Init(dict)
+
+	expected := ac.Run(text)
+	ret := stream.Run(text)
+	if len(ret) != len(expected) {
+		t.Fatalf("Unexpected results %v, want %v", ret, expected)
+	}
+	for i := range ret {
+		if ret[i] != expected[i] {
+			t.Errorf("Mismatched result %v, want %v", ret[i], expected[i])
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package ahocorasick
+
+const (
+	bloomBitsPerWord = 10
+	bloomHashes      = 7 // about 1% false positives at 10 bits per word
+)
+
+// bloomFilter tells whether a word may be in the dictionary, without false
+// negatives.
+type bloomFilter struct {
+	bits []uint64
+	mask uint64 // of bit indexes
+	fold bool   // hash ASCII upper case bytes as lower case
+}
+
+func newBloomFilter(words []string, fold bool) *bloomFilter {
+	// a power of two words, for masking instead of modulo by the size
+	n := 1
+	for n*64 < len(words)*bloomBitsPerWord {
+		n *= 2
+	}
+	f := &bloomFilter{bits: make([]uint64, n), mask: uint64(n*64 - 1), fold: fold}
+	for _, word := range words {
+		h1, h2 := f.hash(word)
+		for i := uint64(0); i < bloomHashes; i++ {
+			bit := (h1 + i*h2) & f.mask
+			f.bits[bit/64] |= 1 << (bit % 64)
+		}
+	}
+	return f
+}
+
+// mayContain returns false if `word` is certainly not in the dictionary.
+func (f *bloomFilter) mayContain(word string) bool {
+	h1, h2 := f.hash(word)
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) & f.mask
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// hash returns the two hashes of `word` combined into the bloomHashes ones,
+// from 64-bit FNV-1a.
+func (f *bloomFilter) hash(word string) (uint64, uint64) {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(word); i++ {
+		c := word[i]
+		if f.fold && 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		h ^= uint64(c)
+		h *= 1099511628211
+	}
+	return h, h>>32 | 1
+}
+
+func (f *bloomFilter) sizeBytes() int {
+	return len(f.bits) * 8
+}
@@ -0,0 +1,30 @@
+package ahocorasick
+
+import (
+	"encoding/json"
+)
+
+// MarshalJSON encodes the dictionary as an object mapping each word, as
+// Dump returns it, to its value. Values must be JSON-marshalable.
+func (s *Searcher) MarshalJSON() ([]byte, error) {
+	dict := make(map[string]interface{})
+	for _, e := range s.Dump(ByTrie) {
+		dict[e.Word] = e.Value
+	}
+	return json.Marshal(dict)
+}
+
+// UnmarshalSearcher builds a searcher from a dictionary encoded by
+// MarshalJSON. It's lossy: values come back as decoded by encoding/json,
+// e.g. numbers as float64, and the builder options are not kept.
+func UnmarshalSearcher(data []byte) (*Searcher, error) {
+	var dict map[string]interface{}
+	if err := json.Unmarshal(data, &dict); err != nil {
+		return nil, err
+	}
+	b := NewBuilder()
+	for word, value := range dict {
+		b.Add(word, value)
+	}
+	return b.BuildE()
+}
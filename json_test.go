@@ -0,0 +1,35 @@
+package ahocorasick
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	builder := NewBuilder()
+	words := []string{"床前", "月光", "明月", "地上", "霜", "是"}
+	for _, word := range words {
+		builder.Add(word, "v:"+word)
+	}
+	searcher := builder.Build()
+	data, err := json.Marshal(searcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := UnmarshalSearcher(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, word := range words {
+		if ok, value := restored.Search(word); !ok || value != "v:"+word {
+			t.Errorf("Unexpected value %v for '%v'", value, word)
+		}
+	}
+	if !restored.Equal(searcher) {
+		t.Error("Expect the restored searcher to be equal")
+	}
+
+	if _, err := UnmarshalSearcher([]byte("[1]")); err == nil {
+		t.Error("Expect an error for a non-object")
+	}
+}
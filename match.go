@@ -0,0 +1,521 @@
+package ahocorasick
+
+import (
+	"sort"
+	"strings"
+)
+
+// Match is an occurrence of a dictionary word in a text.
+type Match struct {
+	// Start and End are the byte offsets of the word, End exclusive.
+	Start, End int
+	// Value is the one stored for the word.
+	Value interface{}
+	// State is the automaton state where the word ends.
+	State int
+}
+
+// scan walks over `text` and calls `emit` for every word ending at each
+// position with its terminal state, value index and exclusive end offset,
+// leaving out WholeWord words not delimited there. The scan stops once
+// `emit` returns false.
+func (s *Searcher) scan(text string, emit func(state, index, end int) bool) {
+	text = s.prepare(text)
+	state := 0
+	for i := 0; i < len(text); i++ {
+		state = s.step(state, text[i])
+		for checkState := state; ; checkState = s.suffixLink[checkState] {
+			if index, ok := s.isTerminal(checkState); ok && (s.modes == nil || s.fitsAt(text, checkState, i+1)) {
+				if !emit(checkState, index, i+1) {
+					return
+				}
+			}
+			if checkState == 0 {
+				break
+			}
+		}
+	}
+}
+
+func (s *Searcher) fitsAt(text string, state, end int) bool {
+	before, after := -1, -1
+	if start := end - s.depth(state); start > 0 {
+		before = int(text[start-1])
+	}
+	if end < len(text) {
+		after = int(text[end])
+	}
+	return s.fits(state, before, after)
+}
+
+// CoverWithPositions returns every occurrence of words in the given `text`,
+// ordered by end offset and then from the longest word to the shortest.
+func (s *Searcher) CoverWithPositions(text string) []Match {
+	ret := make([]Match, 0)
+	s.scan(text, func(state, index, end int) bool {
+		if val := s.value(index); val != nil {
+			ret = append(ret, Match{end - s.depth(state), end, val, state})
+		}
+		return true
+	})
+	return ret
+}
+
+// CoverReverse returns every occurrence of words in the given `text`, as
+// CoverWithPositions does, ordered from the last start offset to the first
+// and then from the longest word to the shortest, e.g. for parsers going
+// backward. It sorts the matches of the usual left-to-right scan rather than
+// scanning right to left.
+func (s *Searcher) CoverReverse(text string) []Match {
+	ret := s.CoverWithPositions(text)
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Start != ret[j].Start {
+			return ret[i].Start > ret[j].Start
+		}
+		return ret[i].End > ret[j].End
+	})
+	return ret
+}
+
+// LongestMatch returns the occurrence of the longest word in the given
+// `text`, the one starting first among words of the same length, or false
+// if no word occurs.
+func (s *Searcher) LongestMatch(text string) (Match, bool) {
+	var ret Match
+	found := false
+	s.scan(text, func(state, index, end int) bool {
+		val := s.value(index)
+		if val == nil {
+			return true
+		}
+		if d := s.depth(state); !found || d > ret.End-ret.Start {
+			ret = Match{end - d, end, val, state}
+			found = true
+		}
+		return true
+	})
+	return ret, found
+}
+
+// CountMatches returns the number of occurrences of words in the given
+// `text`, i.e. the length of CoverWithPositions without building it.
+func (s *Searcher) CountMatches(text string) int {
+	n := 0
+	s.scan(text, func(state, index, end int) bool {
+		if s.value(index) != nil {
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+// CoverOffsets writes the byte offsets of word occurrences in `text` into
+// `starts` and `ends`, in the order of CoverWithPositions, and returns how
+// many were written. It stops once either slice is full and never allocates
+// unless Normalize is set.
+func (s *Searcher) CoverOffsets(text []byte, starts, ends []int) int {
+	if s.normalize != nil {
+		text = []byte(s.prepare(string(text)))
+	}
+	n := 0
+	limit := len(starts)
+	if len(ends) < limit {
+		limit = len(ends)
+	}
+	state := 0
+	for i := 0; i < len(text) && n < limit; i++ {
+		state = s.step(state, text[i])
+		for checkState := state; n < limit; checkState = s.suffixLink[checkState] {
+			if index, ok := s.isTerminal(checkState); ok && s.value(index) != nil {
+				start := i + 1 - s.depth(checkState)
+				before, after := -1, -1
+				if start > 0 {
+					before = int(text[start-1])
+				}
+				if i+1 < len(text) {
+					after = int(text[i+1])
+				}
+				if s.fits(checkState, before, after) {
+					starts[n] = start
+					ends[n] = i + 1
+					n++
+				}
+			}
+			if checkState == 0 {
+				break
+			}
+		}
+	}
+	return n
+}
+
+// CoverDetailed is like Cover but also tells for each value whether its word
+// was first reached directly as the current state of the scan, or through
+// the suffix links of a longer traversal. It's meant for debugging overlaps.
+func (s *Searcher) CoverDetailed(text string) []struct {
+	Value         interface{}
+	ViaSuffixLink bool
+} {
+	ret := make([]struct {
+		Value         interface{}
+		ViaSuffixLink bool
+	}, 0)
+	text = s.prepare(text)
+	seen := make(map[int]struct{})
+	state := 0
+	for i := 0; i < len(text); i++ {
+		state = s.step(state, text[i])
+		for checkState := state; ; checkState = s.suffixLink[checkState] {
+			if index, ok := s.isTerminal(checkState); ok && (s.modes == nil || s.fitsAt(text, checkState, i+1)) {
+				if _, ok := seen[checkState]; !ok {
+					seen[checkState] = struct{}{}
+					if val := s.value(index); val != nil {
+						ret = append(ret, struct {
+							Value         interface{}
+							ViaSuffixLink bool
+						}{val, checkState != state})
+					}
+				}
+			}
+			if checkState == 0 {
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// CoverPaths is like Cover but also returns for each value the bytes of its
+// word as found along the automaton path, i.e. reversed for a searcher
+// built with ReverseMatch and normalized for one with Normalize.
+func (s *Searcher) CoverPaths(text string) []struct {
+	Value interface{}
+	Path  []byte
+} {
+	ret := make([]struct {
+		Value interface{}
+		Path  []byte
+	}, 0)
+	s.coverStates(text, coverScan{seen: make(map[int]struct{})}, func(state, index int) {
+		if val := s.value(index); val != nil {
+			ret = append(ret, struct {
+				Value interface{}
+				Path  []byte
+			}{val, s.path(state)})
+		}
+	})
+	return ret
+}
+
+// CoverGrouped maps the value of each word covered by the given `text` to the
+// start offsets of its occurrences. Values must be comparable to be used as
+// map keys.
+func (s *Searcher) CoverGrouped(text string) map[interface{}][]int {
+	ret := make(map[interface{}][]int)
+	s.scan(text, func(state, index, end int) bool {
+		if val := s.value(index); val != nil {
+			ret[val] = append(ret[val], end-s.depth(state))
+		}
+		return true
+	})
+	return ret
+}
+
+// CoverSuffixes returns the values of words which are suffixes of the given
+// `text`, from the shortest to the longest. It needs a searcher built with
+// ReverseMatch and returns nil otherwise.
+func (s *Searcher) CoverSuffixes(text string) []interface{} {
+	if !s.reversed {
+		return nil
+	}
+	text = s.prepare(text)
+	ret := make([]interface{}, 0)
+	state := 0
+	for i := len(text) - 1; i >= 0; i-- {
+		nextState, ok := s.child(state, text[i])
+		if !ok {
+			break
+		}
+		state = nextState
+		if index, ok := s.isTerminal(state); ok {
+			if val := s.value(index); val != nil {
+				ret = append(ret, val)
+			}
+		}
+	}
+	return ret
+}
+
+// CoverExcluding is like Cover but drops the occurrences overlapping any of
+// the `[start, end)` byte ranges in `ranges`.
+func (s *Searcher) CoverExcluding(text string, ranges [][2]int) []interface{} {
+	ret := make([]interface{}, 0)
+	seen := make(map[int]struct{})
+	s.scan(text, func(state, index, end int) bool {
+		if _, ok := seen[state]; ok {
+			return true
+		}
+		start := end - s.depth(state)
+		for _, r := range ranges {
+			if start < r[1] && r[0] < end {
+				return true
+			}
+		}
+		seen[state] = struct{}{}
+		if val := s.value(index); val != nil {
+			ret = append(ret, val)
+		}
+		return true
+	})
+	return ret
+}
+
+// CoverSkipping is like Cover but steps over the bytes of `text` accepted by
+// `skip`, without resetting the scan, e.g. to find "password" in
+// "p-a-s-s-w-o-r-d". WholeWord words are checked against the bytes around
+// the match in the original text.
+func (s *Searcher) CoverSkipping(text string, skip func(b byte) bool) []interface{} {
+	text = s.prepare(text)
+	ret := make([]interface{}, 0)
+	seen := make(map[int]struct{})
+	var offsets []int // of the bytes stepped over, for WholeWord
+	state := 0
+	for i := 0; i < len(text); i++ {
+		if skip(text[i]) {
+			continue
+		}
+		if s.modes != nil {
+			offsets = append(offsets, i)
+		}
+		state = s.step(state, text[i])
+		for checkState := state; checkState != 0; checkState = s.suffixLink[checkState] {
+			if _, ok := seen[checkState]; ok {
+				continue
+			}
+			index, ok := s.isTerminal(checkState)
+			if !ok {
+				continue
+			}
+			if s.modes != nil {
+				before, after := -1, -1
+				if start := offsets[len(offsets)-s.depth(checkState)]; start > 0 {
+					before = int(text[start-1])
+				}
+				if i+1 < len(text) {
+					after = int(text[i+1])
+				}
+				if !s.fits(checkState, before, after) {
+					continue
+				}
+			}
+			seen[checkState] = struct{}{}
+			if val := s.value(index); val != nil {
+				ret = append(ret, val)
+			}
+		}
+	}
+	return ret
+}
+
+// CoverTokens is like Cover but only takes the occurrences delimited by
+// ASCII whitespace or the ends of `text`, i.e. made of whole tokens. See
+// WhitespaceNormalized for words of several tokens.
+func (s *Searcher) CoverTokens(text string) []interface{} {
+	prepared := s.prepare(text)
+	ret := make([]interface{}, 0)
+	seen := make(map[int]struct{})
+	s.scan(text, func(state, index, end int) bool {
+		if _, ok := seen[state]; ok {
+			return true
+		}
+		start := end - s.depth(state)
+		if start > 0 && !isSpace(prepared[start-1]) || end < len(prepared) && !isSpace(prepared[end]) {
+			return true
+		}
+		seen[state] = struct{}{}
+		if val := s.value(index); val != nil {
+			ret = append(ret, val)
+		}
+		return true
+	})
+	return ret
+}
+
+// TokenPolicy tells how Tokenize picks among overlapping matches.
+type TokenPolicy int
+
+const (
+	// LongestLeftmost takes the longest of the matches starting first.
+	LongestLeftmost TokenPolicy = iota
+	// ShortestLeftmost takes the shortest of the matches starting first.
+	ShortestLeftmost
+	// MaxCoverage takes the non-overlapping matches covering the most bytes,
+	// preferring fewer tokens on ties.
+	MaxCoverage
+)
+
+// Tokenize returns non-overlapping matches of words in the given `text`,
+// ordered by offset and chosen according to `policy`.
+func (s *Searcher) Tokenize(text string, policy TokenPolicy) []Match {
+	matches := s.CoverWithPositions(text)
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Start != matches[j].Start {
+			return matches[i].Start < matches[j].Start
+		}
+		if policy == ShortestLeftmost {
+			return matches[i].End < matches[j].End
+		}
+		return matches[i].End > matches[j].End
+	})
+	if policy == MaxCoverage {
+		return maxCoverage(len(s.prepare(text)), matches)
+	}
+
+	ret := make([]Match, 0)
+	pos := 0
+	for _, m := range matches {
+		if m.Start >= pos {
+			ret = append(ret, m)
+			pos = m.End
+		}
+	}
+	return ret
+}
+
+// maxCoverage picks the tokens by dynamic programming over the matches
+// sorted by start offset.
+func maxCoverage(n int, matches []Match) []Match {
+	type choice struct {
+		covered, tokens int
+		match           int // index in matches, -1 to skip the byte
+	}
+	best := make([]choice, n+1)
+	best[n] = choice{0, 0, -1}
+	for i := n - 1; i >= 0; i-- {
+		best[i] = choice{best[i+1].covered, best[i+1].tokens, -1}
+		k := sort.Search(len(matches), func(k int) bool { return matches[k].Start >= i })
+		for ; k < len(matches) && matches[k].Start == i; k++ {
+			m := matches[k]
+			covered := m.End - m.Start + best[m.End].covered
+			tokens := 1 + best[m.End].tokens
+			if covered > best[i].covered || covered == best[i].covered && tokens < best[i].tokens {
+				best[i] = choice{covered, tokens, k}
+			}
+		}
+	}
+
+	ret := make([]Match, 0)
+	for i := 0; i < n; {
+		if k := best[i].match; k >= 0 {
+			ret = append(ret, matches[k])
+			i = matches[k].End
+			continue
+		}
+		i++
+	}
+	return ret
+}
+
+// Partition splits the given `text` into the matches Tokenize picks with
+// LongestLeftmost and the `[start, end)` byte ranges between them, so that
+// together they cover the whole text.
+func (s *Searcher) Partition(text string) (matches []Match, gaps [][2]int) {
+	matches = s.Tokenize(text, LongestLeftmost)
+	gaps = make([][2]int, 0)
+	pos := 0
+	for _, m := range matches {
+		if m.Start > pos {
+			gaps = append(gaps, [2]int{pos, m.Start})
+		}
+		pos = m.End
+	}
+	if n := len(s.prepare(text)); n > pos {
+		gaps = append(gaps, [2]int{pos, n})
+	}
+	return matches, gaps
+}
+
+// SplitOnMatches returns the pieces of the given `text` between the matches
+// Partition picks, using the words as delimiters. Empty pieces, e.g. between
+// adjacent matches, are dropped if `dropEmpty` is set.
+func (s *Searcher) SplitOnMatches(text string, dropEmpty bool) []string {
+	prepared := s.prepare(text)
+	matches, _ := s.Partition(text)
+	ret := make([]string, 0, len(matches)+1)
+	pos := 0
+	for _, m := range append(matches, Match{Start: len(prepared)}) {
+		if piece := prepared[pos:m.Start]; len(piece) > 0 || !dropEmpty {
+			ret = append(ret, piece)
+		}
+		pos = m.End
+	}
+	return ret
+}
+
+// Mask returns the given `text` with the bytes of each match picked by
+// Tokenize with LongestLeftmost replaced by `maskByte`, so the length in
+// bytes doesn't change. A multi-byte character becomes several mask bytes,
+// see MaskRunes to keep the length in characters instead. With Normalize,
+// the normalized text is masked.
+func (s *Searcher) Mask(text string, maskByte byte) string {
+	ret := []byte(s.prepare(text))
+	for _, m := range s.Tokenize(text, LongestLeftmost) {
+		for i := m.Start; i < m.End; i++ {
+			ret[i] = maskByte
+		}
+	}
+	return string(ret)
+}
+
+// MaskRunes is like Mask but replaces each character of the matches by
+// `mask`, so the length in characters doesn't change.
+func (s *Searcher) MaskRunes(text string, mask rune) string {
+	prepared := s.prepare(text)
+	var sb strings.Builder
+	pos := 0
+	for _, m := range s.Tokenize(text, LongestLeftmost) {
+		sb.WriteString(prepared[pos:m.Start])
+		for range prepared[m.Start:m.End] {
+			sb.WriteRune(mask)
+		}
+		pos = m.End
+	}
+	sb.WriteString(prepared[pos:])
+	return sb.String()
+}
+
+// IsFullyCovered returns true if every byte of the given `text` lies within
+// some occurrence of a word, which may overlap each other. An empty text is
+// fully covered.
+func (s *Searcher) IsFullyCovered(text string) bool {
+	// +1 where a span starts and -1 where it ends
+	delta := make([]int, len(s.prepare(text))+1)
+	s.scan(text, func(state, index, end int) bool {
+		if s.value(index) != nil {
+			delta[end-s.depth(state)]++
+			delta[end]--
+		}
+		return true
+	})
+	spans := 0
+	for _, d := range delta[:len(delta)-1] {
+		if spans += d; spans == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchStartMask returns a mask over the bytes of the given `text`, true
+// where some word starts.
+func (s *Searcher) MatchStartMask(text string) []bool {
+	mask := make([]bool, len(s.prepare(text)))
+	s.scan(text, func(state, index, end int) bool {
+		if s.value(index) != nil {
+			mask[end-s.depth(state)] = true
+		}
+		return true
+	})
+	return mask
+}
@@ -0,0 +1,375 @@
+package ahocorasick
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCoverWithPositions(t *testing.T) {
+	builder := NewBuilder()
+	words := []string{"abash", "unabashed", "x"}
+	for _, word := range words {
+		builder.Add(word, word)
+	}
+	searcher := builder.Build()
+	text := "unabashed x"
+	ret := searcher.CoverWithPositions(text)
+	if len(ret) != 3 {
+		t.Fatal("Unexpected matches:", ret)
+	}
+	expected := []struct {
+		start, end int
+		value      string
+	}{{2, 7, "abash"}, {0, 9, "unabashed"}, {10, 11, "x"}}
+	for i, m := range ret {
+		if m.Start != expected[i].start || m.End != expected[i].end || m.Value != expected[i].value {
+			t.Errorf("Unexpected match: %+v", m)
+		}
+		if text[m.Start:m.End] != m.Value {
+			t.Errorf("Span mismatched for %+v", m)
+		}
+		state, _ := searcher.prefixSearch(expected[i].value)
+		if m.State != state {
+			t.Errorf("State mismatched for %+v", m)
+		}
+	}
+}
+
+func TestCoverReverse(t *testing.T) {
+	builder := NewBuilder()
+	for _, word := range []string{"he", "she", "his", "hers", "s"} {
+		builder.Add(word, word)
+	}
+	searcher := builder.Build()
+	text := "ushers his"
+	ret := searcher.CoverReverse(text)
+	expected := searcher.CoverWithPositions(text)
+	sort.Slice(expected, func(i, j int) bool {
+		if expected[i].Start != expected[j].Start {
+			return expected[i].Start < expected[j].Start
+		}
+		return expected[i].End < expected[j].End
+	})
+	if len(ret) != len(expected) {
+		t.Fatalf("Unexpected matches %v, want %v", ret, expected)
+	}
+	for i, m := range ret {
+		if m != expected[len(expected)-1-i] {
+			t.Errorf("Unexpected match %+v, want %+v", m, expected[len(expected)-1-i])
+		}
+	}
+	if ret[0].Start != 9 || ret[0].Value != "s" || ret[len(ret)-1].Start != 1 {
+		t.Error("Unexpected ends of the matches:", ret)
+	}
+}
+
+func TestLongestMatch(t *testing.T) {
+	searcher := NewBuilder().Add("ab", "ab").Add("abcd", "abcd").Add("cd", "cd").Build()
+	m, ok := searcher.LongestMatch("xabcdy")
+	if !ok || m.Value != "abcd" || m.Start != 1 || m.End != 5 {
+		t.Error("Unexpected longest match:", m)
+	}
+	if m, ok := searcher.LongestMatch("cd ab"); !ok || m.Value != "cd" {
+		t.Error("Expect the earliest of equal lengths:", m)
+	}
+	if _, ok := searcher.LongestMatch("xyz"); ok {
+		t.Error("Unexpected match")
+	}
+}
+
+func TestCountMatches(t *testing.T) {
+	searcher := NewBuilder().Add("a", 1).Add("aa", 2).Add("b", nil).Build()
+	if n := searcher.CountMatches("aaab"); n != 5 {
+		t.Error("Unexpected count:", n)
+	}
+	if n := searcher.CountMatches("xyz"); n != 0 {
+		t.Error("Unexpected count:", n)
+	}
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	searcher := NewBuilder().CaseInsensitive().Add("Hello", "hello").Add("there", "there").Build()
+	text := "say HeLLo there, hello"
+	ret := searcher.CoverWithPositions(text)
+	if len(ret) != 3 || text[ret[0].Start:ret[0].End] != "HeLLo" || ret[2].Start != 17 {
+		t.Fatal("Unexpected matches:", ret)
+	}
+	if ok, value := searcher.Search("HELLO"); !ok || value != "hello" {
+		t.Errorf("Unexpected value %v for 'HELLO'", value)
+	}
+
+	var buf bytes.Buffer
+	if err := searcher.WriteStructure(&buf); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := ReadStructure(&buf, func(word string) interface{} { return word })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret := restored.Cover("THERE"); len(ret) != 1 || ret[0] != "there" {
+		t.Error("Unexpected matches after reading the structure:", ret)
+	}
+}
+
+func TestCoverOffsets(t *testing.T) {
+	builder := NewBuilder()
+	words := []string{"床前", "月光", "明月", "地上", "霜", "是"}
+	for _, word := range words {
+		builder.Add(word, word)
+	}
+	searcher := builder.Build()
+	text := "床前明月光x，a疑是地上霜"
+	expected := searcher.CoverWithPositions(text)
+
+	starts := make([]int, 16)
+	ends := make([]int, 16)
+	n := searcher.CoverOffsets([]byte(text), starts, ends)
+	if n != len(expected) {
+		t.Fatalf("Unexpected count %v, want %v", n, len(expected))
+	}
+	for i, m := range expected {
+		if starts[i] != m.Start || ends[i] != m.End {
+			t.Errorf("Offsets mismatched at %v: [%v,%v) vs %+v", i, starts[i], ends[i], m)
+		}
+	}
+
+	// stops at the capacity of the given arrays
+	if n := searcher.CoverOffsets([]byte(text), starts[:2], ends); n != 2 {
+		t.Errorf("Unexpected count %v for short arrays", n)
+	}
+}
+
+func TestCoverDetailed(t *testing.T) {
+	searcher := NewBuilder().Add("abash", "abash").Add("unabashed", "unabashed").Build()
+	ret := searcher.CoverDetailed("unabashed")
+	if len(ret) != 2 {
+		t.Fatal("Unexpected matches:", ret)
+	}
+	if ret[0].Value != "abash" || !ret[0].ViaSuffixLink {
+		t.Errorf("Expect 'abash' via suffix link: %+v", ret[0])
+	}
+	if ret[1].Value != "unabashed" || ret[1].ViaSuffixLink {
+		t.Errorf("Expect 'unabashed' directly: %+v", ret[1])
+	}
+}
+
+func TestCoverPaths(t *testing.T) {
+	for _, builder := range []*Builder{NewBuilder(), NewBuilder().RemapAlphabet()} {
+		words := []string{"床前", "月光", "明月", "地上", "霜", "是"}
+		for _, word := range words {
+			builder.Add(word, word)
+		}
+		ret := builder.Build().CoverPaths("床前明月光x，a疑是地上霜")
+		if len(ret) != len(words) {
+			t.Fatal("Fail to cover enough words:", ret)
+		}
+		for _, r := range ret {
+			if string(r.Path) != r.Value {
+				t.Errorf("Unexpected path %q for %v", r.Path, r.Value)
+			}
+		}
+	}
+}
+
+func TestCoverGrouped(t *testing.T) {
+	searcher := NewBuilder().Add("bad", "bad").Add("word", "word").Build()
+	ret := searcher.CoverGrouped("bad word, bad")
+	if len(ret) != 2 {
+		t.Fatal("Unexpected groups:", ret)
+	}
+	if starts := ret["bad"]; len(starts) != 2 || starts[0] != 0 || starts[1] != 10 {
+		t.Error("Unexpected offsets for 'bad':", starts)
+	}
+	if starts := ret["word"]; len(starts) != 1 || starts[0] != 4 {
+		t.Error("Unexpected offsets for 'word':", starts)
+	}
+}
+
+func TestCoverSuffixes(t *testing.T) {
+	searcher := NewBuilder().ReverseMatch().
+		Add(".go", ".go").Add("o", "o").Add(".rs", ".rs").Add("main", "main").Build()
+	ret := searcher.CoverSuffixes("main.go")
+	if len(ret) != 2 || ret[0] != "o" || ret[1] != ".go" {
+		t.Error("Unexpected suffixes:", ret)
+	}
+	if ret := searcher.CoverSuffixes("main.c"); len(ret) != 0 {
+		t.Error("Unexpected suffixes:", ret)
+	}
+
+	searcher = NewBuilder().Add(".go", ".go").Build()
+	if ret := searcher.CoverSuffixes("main.go"); ret != nil {
+		t.Error("Unexpected suffixes without ReverseMatch:", ret)
+	}
+}
+
+func TestCoverSkipping(t *testing.T) {
+	searcher := NewBuilder().Add("password", "password").Add("word", "word").Build()
+	skip := func(b byte) bool { return b == '-' }
+	ret := searcher.CoverSkipping("my p-a-s-s-w-o-r-d", skip)
+	if len(ret) != 2 || ret[0] != "password" || ret[1] != "word" {
+		t.Error("Unexpected covered words:", ret)
+	}
+	if ret := searcher.CoverSkipping("pass-word", func(byte) bool { return false }); len(ret) != 1 || ret[0] != "word" {
+		t.Error("Unexpected covered words:", ret)
+	}
+
+	searcher = NewBuilder().AddWithMode("pass", "pass", WholeWord).Build()
+	if ret := searcher.CoverSkipping("a p-a-s-s.", skip); len(ret) != 1 {
+		t.Error("Unexpected covered words:", ret)
+	}
+	if ret := searcher.CoverSkipping("ap-a-s-s", skip); len(ret) != 0 {
+		t.Error("Unexpected covered words:", ret)
+	}
+}
+
+func TestCoverTokens(t *testing.T) {
+	searcher := NewBuilder().Add("cat", "cat").Add("dog", "dog").Build()
+	if ret := searcher.CoverTokens("bobcat dogs"); len(ret) != 0 {
+		t.Error("Unexpected covered words:", ret)
+	}
+
+	searcher = NewBuilder().WhitespaceNormalized().
+		Add("cat", "cat").Add(" hot \t dog ", "hot dog").Add("dog", "dog").Build()
+	ret := searcher.CoverTokens("  cat   hot\n\ndog \t")
+	if len(ret) != 3 || ret[0] != "cat" || ret[1] != "hot dog" || ret[2] != "dog" {
+		t.Error("Unexpected covered words:", ret)
+	}
+	if ret := searcher.CoverTokens("cat     dog"); len(ret) != 2 || ret[0] != "cat" || ret[1] != "dog" {
+		t.Error("Unexpected covered words:", ret)
+	}
+	if ret := searcher.CoverTokens("bobcat   hotdog"); len(ret) != 0 {
+		t.Error("Unexpected covered words:", ret)
+	}
+	if !searcher.Contains("hot   dog") {
+		t.Error("Expect queries to be normalized too")
+	}
+}
+
+func TestCoverExcluding(t *testing.T) {
+	searcher := NewBuilder().Add("bad", "bad").Add("word", "word").Build()
+	text := "bad QmFkd29yZA== word"
+	ret := searcher.CoverExcluding(text, [][2]int{{0, 3}})
+	if len(ret) != 1 || ret[0] != "word" {
+		t.Error("Unexpected covered words:", ret)
+	}
+	// an excluded occurrence doesn't hide later ones
+	ret = searcher.CoverExcluding("bad bad", [][2]int{{1, 2}})
+	if len(ret) != 1 || ret[0] != "bad" {
+		t.Error("Unexpected covered words:", ret)
+	}
+	if ret := searcher.CoverExcluding(text, nil); len(ret) != 2 {
+		t.Error("Unexpected covered words:", ret)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	builder := NewBuilder()
+	for _, word := range []string{"ab", "bc", "a", "b", "c", "bcd"} {
+		builder.Add(word, word)
+	}
+	searcher := builder.Build()
+	tokens := func(text string, policy TokenPolicy) []string {
+		var ret []string
+		for _, m := range searcher.Tokenize(text, policy) {
+			if text[m.Start:m.End] != m.Value {
+				t.Errorf("Span mismatched for %+v", m)
+			}
+			ret = append(ret, m.Value.(string))
+		}
+		return ret
+	}
+	cases := []struct {
+		text     string
+		policy   TokenPolicy
+		expected []string
+	}{
+		{"abc", LongestLeftmost, []string{"ab", "c"}},
+		{"abc", ShortestLeftmost, []string{"a", "b", "c"}},
+		{"abc", MaxCoverage, []string{"ab", "c"}},
+		{"abcd", LongestLeftmost, []string{"ab", "c"}},
+		{"abcd", MaxCoverage, []string{"a", "bcd"}},
+		{"x", MaxCoverage, nil},
+	}
+	for _, c := range cases {
+		ret := tokens(c.text, c.policy)
+		if strings.Join(ret, ",") != strings.Join(c.expected, ",") {
+			t.Errorf("Unexpected tokens %v of '%v' by policy %v, want %v", ret, c.text, c.policy, c.expected)
+		}
+	}
+}
+
+func TestPartition(t *testing.T) {
+	searcher := NewBuilder().Add("bad", "bad").Add("badword", "badword").Build()
+	matches, gaps := searcher.Partition("x badword y")
+	if len(matches) != 1 || matches[0].Value != "badword" || matches[0].Start != 2 || matches[0].End != 9 {
+		t.Error("Unexpected matches:", matches)
+	}
+	if len(gaps) != 2 || gaps[0] != [2]int{0, 2} || gaps[1] != [2]int{9, 11} {
+		t.Error("Unexpected gaps:", gaps)
+	}
+	if matches, gaps := searcher.Partition("bad"); len(matches) != 1 || len(gaps) != 0 {
+		t.Error("Unexpected partition of a single word:", matches, gaps)
+	}
+}
+
+func TestSplitOnMatches(t *testing.T) {
+	searcher := NewBuilder().Add(",", 1).Add(" ", 2).Build()
+	ret := searcher.SplitOnMatches("a, b c", true)
+	if len(ret) != 3 || ret[0] != "a" || ret[1] != "b" || ret[2] != "c" {
+		t.Errorf("Unexpected pieces %q", ret)
+	}
+	ret = searcher.SplitOnMatches("a, b c,", false)
+	if len(ret) != 5 || ret[1] != "" || ret[4] != "" {
+		t.Errorf("Unexpected pieces %q with empties", ret)
+	}
+}
+
+func TestMask(t *testing.T) {
+	searcher := NewBuilder().Add("secret", 1).Add("sec", 2).Add("明月", 3).Build()
+	if ret := searcher.Mask("my secret is safe", '*'); ret != "my ****** is safe" {
+		t.Errorf("Unexpected masked text '%v'", ret)
+	}
+	if ret := searcher.Mask("床前明月光", '*'); len(ret) != len("床前明月光") || ret != "床前******光" {
+		t.Errorf("Unexpected masked text '%v'", ret)
+	}
+	if ret := searcher.MaskRunes("床前明月光 secret", '*'); ret != "床前**光 ******" {
+		t.Errorf("Unexpected masked text '%v'", ret)
+	}
+}
+
+func TestIsFullyCovered(t *testing.T) {
+	searcher := NewBuilder().Add("abc", 1).Add("cde", 2).Add("ef", 3).Build()
+	if !searcher.IsFullyCovered("abcdef") {
+		t.Error("Expect overlapping words to cover the text")
+	}
+	if searcher.IsFullyCovered("abcxdef") {
+		t.Error("Unexpected full cover with a gap")
+	}
+	if searcher.IsFullyCovered("abcdefg") {
+		t.Error("Unexpected full cover with a trailing byte")
+	}
+	if !searcher.IsFullyCovered("") {
+		t.Error("Expect an empty text to be fully covered")
+	}
+}
+
+func TestMatchStartMask(t *testing.T) {
+	builder := NewBuilder()
+	words := []string{"床前", "月光", "明月", "地上", "霜", "是"}
+	for _, word := range words {
+		builder.Add(word, word)
+	}
+	searcher := builder.Build()
+	mask := searcher.MatchStartMask("床前明月光")
+	if len(mask) != len("床前明月光") {
+		t.Fatal("Unexpected mask length:", len(mask))
+	}
+	for i, starts := range mask {
+		expected := i == 0 || i == 6 || i == 9
+		if starts != expected {
+			t.Errorf("Unexpected mask %v at %v", starts, i)
+		}
+	}
+}
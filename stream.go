@@ -0,0 +1,208 @@
+package ahocorasick
+
+import (
+	"bufio"
+	"io"
+)
+
+// ScanState is the automaton position kept across Feed calls. The zero value
+// starts from root.
+type ScanState struct {
+	state int
+}
+
+// Feed advances `st` over `chunk` and calls `onMatch` for every occurrence
+// of words ending within it. Offsets are relative to the beginning of
+// `chunk`, so Start is negative for a word begun in previous chunks; add the
+// number of bytes fed so far to get offsets in the whole stream. WholeWord
+// words are reported like Substring ones since the next chunk is unknown,
+// and chunks are not normalized as they may split characters.
+func (s *Searcher) Feed(st *ScanState, chunk []byte, onMatch func(Match)) {
+	state := st.state
+	for i, c := range chunk {
+		state = s.step(state, c)
+		for checkState := state; ; checkState = s.suffixLink[checkState] {
+			if index, ok := s.isTerminal(checkState); ok {
+				if val := s.value(index); val != nil {
+					onMatch(Match{i + 1 - s.depth(checkState), i + 1, val, checkState})
+				}
+			}
+			if checkState == 0 {
+				break
+			}
+		}
+	}
+	st.state = state
+}
+
+// CoverContinue is like Cover but begins from `startState`, 0 for a fresh
+// scan, and returns the state it ended in so that the next chunk continues
+// the words begun in this one. Like Feed, WholeWord words are matched as
+// substrings and `text` is not normalized.
+func (s *Searcher) CoverContinue(text string, startState int) (matches []interface{}, endState int) {
+	st := ScanState{startState}
+	seen := make(map[int]struct{})
+	matches = make([]interface{}, 0)
+	s.Feed(&st, []byte(text), func(m Match) {
+		if _, ok := seen[m.State]; !ok {
+			seen[m.State] = struct{}{}
+			matches = append(matches, m.Value)
+		}
+	})
+	return matches, st.state
+}
+
+// ReplaceStream copies `r` to `w`, substituting each match by the bytes
+// returned by `repl`. Overlapping matches are resolved leftmost-longest, and
+// offsets of the matches are counted from the beginning of `r`. At most
+// MaxWordLen bytes are held back to resolve matches spanning reads. Like
+// Feed, WholeWord words are matched as substrings and reads not normalized.
+func (s *Searcher) ReplaceStream(r io.Reader, w io.Writer, repl func(Match) []byte) error {
+	bw := bufio.NewWriter(w)
+	var (
+		buf        []byte // bytes from bufStart not written yet
+		bufStart   int
+		flushed    int // bytes before are written
+		pos        int
+		candidates []Match
+		state      int
+		werr       error
+	)
+	write := func(to int) {
+		if werr == nil && to > flushed {
+			_, werr = bw.Write(buf[flushed-bufStart : to-bufStart])
+		}
+		if to > flushed {
+			flushed = to
+		}
+	}
+	// bytes before `safe` can't be part of a match found later
+	resolve := func(safe int, final bool) {
+		for {
+			if len(candidates) == 0 {
+				write(safe)
+				return
+			}
+			best := candidates[0]
+			for _, m := range candidates[1:] {
+				if m.Start < best.Start || m.Start == best.Start && m.End > best.End {
+					best = m
+				}
+			}
+			// a later match may still start at or before best
+			if !final && safe <= best.Start {
+				write(safe)
+				return
+			}
+			write(best.Start)
+			if werr == nil {
+				_, werr = bw.Write(repl(best))
+			}
+			flushed = best.End
+			n := 0
+			for _, m := range candidates {
+				if m.Start >= flushed {
+					candidates[n] = m
+					n++
+				}
+			}
+			candidates = candidates[:n]
+		}
+	}
+
+	chunk := make([]byte, 4096)
+	for {
+		n, err := r.Read(chunk)
+		for _, c := range chunk[:n] {
+			if flushed-bufStart > len(chunk) {
+				buf = append(buf[:0], buf[flushed-bufStart:]...)
+				bufStart = flushed
+			}
+			buf = append(buf, c)
+			state = s.step(state, c)
+			for checkState := state; ; checkState = s.suffixLink[checkState] {
+				if index, ok := s.isTerminal(checkState); ok {
+					start := pos + 1 - s.depth(checkState)
+					if val := s.value(index); val != nil && start >= flushed {
+						candidates = append(candidates, Match{start, pos + 1, val, checkState})
+					}
+				}
+				if checkState == 0 {
+					break
+				}
+			}
+			pos++
+			resolve(pos-s.maxWordLen, false)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	resolve(pos, true)
+	if werr != nil {
+		return werr
+	}
+	return bw.Flush()
+}
+
+// CoverReader is like Cover over all the bytes read from `r`. Like Feed,
+// WholeWord words are matched as substrings and reads are not normalized.
+func (s *Searcher) CoverReader(r io.Reader) ([]interface{}, error) {
+	ret := make([]interface{}, 0)
+	seen := make(map[int]struct{})
+	state := 0
+	chunk := make([]byte, 4096)
+	for {
+		n, err := r.Read(chunk)
+		for _, c := range chunk[:n] {
+			state = s.step(state, c)
+			for checkState := state; ; checkState = s.suffixLink[checkState] {
+				if _, ok := seen[checkState]; ok {
+					break
+				}
+				seen[checkState] = struct{}{}
+				if index, ok := s.isTerminal(checkState); ok {
+					if val := s.value(index); val != nil {
+						ret = append(ret, val)
+					}
+				}
+			}
+		}
+		if err == io.EOF {
+			return ret, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// CountReader is like CountMatches over all the bytes read from `r`, keeping
+// the automaton state across reads. On a read error, it returns the count
+// so far with the error. Like Feed, WholeWord words are matched as
+// substrings and reads are not normalized.
+func (s *Searcher) CountReader(r io.Reader) (int, error) {
+	count := 0
+	state := 0
+	chunk := make([]byte, 4096)
+	for {
+		n, err := r.Read(chunk)
+		for _, c := range chunk[:n] {
+			state = s.step(state, c)
+			for checkState := state; checkState != 0; checkState = s.suffixLink[checkState] {
+				if index, ok := s.isTerminal(checkState); ok && s.value(index) != nil {
+					count++
+				}
+			}
+		}
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+	}
+}
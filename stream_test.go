@@ -0,0 +1,129 @@
+package ahocorasick
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestFeed(t *testing.T) {
+	searcher := NewBuilder().Add("badword", "badword").Add("or", "or").Build()
+	var st ScanState
+	var matches []Match
+	total := 0
+	for _, chunk := range []string{"bad", "word"} {
+		searcher.Feed(&st, []byte(chunk), func(m Match) {
+			m.Start += total
+			m.End += total
+			matches = append(matches, m)
+		})
+		total += len(chunk)
+	}
+	if len(matches) != 2 {
+		t.Fatal("Unexpected matches:", matches)
+	}
+	if m := matches[0]; m.Start != 4 || m.End != 6 || m.Value != "or" {
+		t.Errorf("Unexpected match: %+v", m)
+	}
+	if m := matches[1]; m.Start != 0 || m.End != 7 || m.Value != "badword" {
+		t.Errorf("Unexpected match: %+v", m)
+	}
+}
+
+func TestCoverContinue(t *testing.T) {
+	searcher := NewBuilder().Add("badword", "badword").Add("bad", "bad").Build()
+	ret, state := searcher.CoverContinue("a badw", 0)
+	if len(ret) != 1 || ret[0] != "bad" {
+		t.Error("Unexpected matches in the first chunk:", ret)
+	}
+	ret, state = searcher.CoverContinue("ord!", state)
+	if len(ret) != 1 || ret[0] != "badword" {
+		t.Error("Fail to match across chunks:", ret)
+	}
+	if _, state = searcher.CoverContinue("x", state); state != 0 {
+		t.Error("Unexpected end state", state)
+	}
+}
+
+func TestReplaceStream(t *testing.T) {
+	searcher := NewBuilder().
+		Add("secret", "secret").Add("bc", "bc").Add("abcd", "abcd").Add("cd", "cd").
+		Build()
+	redact := func(m Match) []byte {
+		return []byte("[" + m.Value.(string) + "]")
+	}
+	cases := []struct{ text, expected string }{
+		{"my secret is xabcdy", "my [secret] is x[abcd]y"},
+		{"secretsecret", "[secret][secret]"},
+		{"abc cd", "a[bc] [cd]"},
+		{"nothing", "nothing"},
+		{"", ""},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		r := iotest.OneByteReader(strings.NewReader(c.text))
+		if err := searcher.ReplaceStream(r, &out, redact); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != c.expected {
+			t.Errorf("Unexpected output '%v', want '%v'", out.String(), c.expected)
+		}
+	}
+
+	// no words at all
+	var out bytes.Buffer
+	searcher = NewBuilder().Add("x", nil).Build()
+	if err := searcher.ReplaceStream(strings.NewReader("abc"), &out, redact); err != nil || out.String() != "abc" {
+		t.Errorf("Unexpected output '%v' (%v)", out.String(), err)
+	}
+}
+
+func TestCoverReader(t *testing.T) {
+	builder := NewBuilder()
+	words := []string{"床前", "月光", "明月", "地上", "霜", "是"}
+	for _, word := range words {
+		builder.Add(word, word)
+	}
+	searcher := builder.Build()
+	text := "床前明月光x，a疑是地上霜"
+	ret, err := searcher.CoverReader(iotest.OneByteReader(strings.NewReader(text)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := searcher.Cover(text)
+	if len(ret) != len(expected) {
+		t.Fatalf("Unexpected covered words %v, want %v", ret, expected)
+	}
+	for i := range ret {
+		if ret[i] != expected[i] {
+			t.Errorf("Mismatched value %v, want %v", ret[i], expected[i])
+		}
+	}
+
+	_, err = searcher.CoverReader(iotest.ErrReader(iotest.ErrTimeout))
+	if err != iotest.ErrTimeout {
+		t.Error("Expect the error of the reader, got", err)
+	}
+}
+
+func TestCountReader(t *testing.T) {
+	builder := NewBuilder()
+	for _, word := range []string{"床前", "月光", "明月", "前明", "霜", "a", "aa"} {
+		builder.Add(word, word)
+	}
+	searcher := builder.Build()
+	text := strings.Repeat("床前明月光x，aaa疑是地上霜", 1000)
+	n, err := searcher.CountReader(iotest.HalfReader(strings.NewReader(text)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := searcher.CountMatches(text); n != expected {
+		t.Errorf("Unexpected count %v, want %v", n, expected)
+	}
+
+	_, err = searcher.CountReader(iotest.ErrReader(iotest.ErrTimeout))
+	if err != iotest.ErrTimeout {
+		t.Error("Expect the error of the reader, got", err)
+	}
+}
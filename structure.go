@@ -0,0 +1,221 @@
+package ahocorasick
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+)
+
+const structureMagic = "ACS1"
+
+// structureChunk is the most elements ReadStructure allocates ahead of the
+// data read.
+const structureChunk = 1 << 16
+
+const (
+	structureReversed = 1 << iota
+	structureModes
+	structureFolded
+)
+
+// ErrBadStructure is returned by ReadStructure for data not written by
+// WriteStructure.
+var ErrBadStructure = errors.New("ahocorasick: bad structure data")
+
+// WriteStructure writes the automaton without its values, which
+// ReadStructure gets back from the words instead. The remapped alphabet,
+// CaseInsensitive, ReverseMatch and WholeWord modes are kept, while
+// Normalize, weights, tags and the insertion order are not.
+func (s *Searcher) WriteStructure(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var err error
+	write := func(data interface{}) {
+		if err == nil {
+			err = binary.Write(bw, binary.LittleEndian, data)
+		}
+	}
+	var flags uint8
+	if s.reversed {
+		flags |= structureReversed
+	}
+	if s.modes != nil {
+		flags |= structureModes
+	}
+	if s.folded {
+		flags |= structureFolded
+	}
+	write([]byte(structureMagic))
+	write(flags)
+	for _, array := range [][]int{s.base, s.check, s.suffixLink} {
+		ints := make([]int64, len(array))
+		for i, v := range array {
+			ints[i] = int64(v)
+		}
+		write(int64(len(ints)))
+		write(ints)
+	}
+	write(int64(len(s.labels)))
+	write(s.labels)
+	if s.modes != nil {
+		modes := make([]byte, len(s.modes))
+		for i, mode := range s.modes {
+			modes[i] = byte(mode)
+		}
+		write(int64(len(modes)))
+		write(modes)
+	}
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ReadStructure reads an automaton written by WriteStructure and values
+// each word by `loader` of it, called once per word on the first access to
+// its value, possibly by concurrent searches. Words which shared a value
+// slot after Compact get one slot each.
+func ReadStructure(r io.Reader, loader func(word string) interface{}) (*Searcher, error) {
+	br := bufio.NewReader(r)
+	var err error
+	read := func(data interface{}) {
+		if err == nil {
+			err = binary.Read(br, binary.LittleEndian, data)
+		}
+	}
+	// lengths are not trusted, so arrays grow by chunks as data arrives
+	readLen := func() int64 {
+		var n int64
+		read(&n)
+		if err == nil && n < 0 {
+			err = ErrBadStructure
+		}
+		return n
+	}
+	readBytes := func() []byte {
+		n := readLen()
+		var data []byte
+		for err == nil && int64(len(data)) < n {
+			chunk := make([]byte, min(n-int64(len(data)), structureChunk))
+			read(chunk)
+			data = append(data, chunk...)
+		}
+		return data
+	}
+	readInts := func() []int {
+		n := readLen()
+		var ints []int
+		for err == nil && int64(len(ints)) < n {
+			chunk := make([]int64, min(n-int64(len(ints)), structureChunk))
+			read(chunk)
+			for _, v := range chunk {
+				ints = append(ints, int(v))
+			}
+		}
+		return ints
+	}
+
+	magic := make([]byte, len(structureMagic))
+	var flags uint8
+	read(magic)
+	read(&flags)
+	if err == nil && string(magic) != structureMagic {
+		err = ErrBadStructure
+	}
+	var arrays [3][]int
+	for k := range arrays {
+		arrays[k] = readInts()
+	}
+	labels := readBytes()
+	var modes []byte
+	if flags&structureModes != 0 {
+		modes = readBytes()
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = ErrBadStructure
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Searcher{
+		base:       arrays[0],
+		check:      arrays[1],
+		suffixLink: arrays[2],
+		reversed:   flags&structureReversed != 0,
+	}
+	if len(labels) > 0 {
+		s.labels = labels
+		s.alphabet = make([]byte, 256)
+		for l := 1; l < len(labels); l++ {
+			s.alphabet[labels[l]] = byte(l)
+			if labels[l] == 0 {
+				s.escapeNull = true
+			}
+		}
+		if flags&structureFolded != 0 {
+			s.folded = true
+			for c := 'A'; c <= 'Z'; c++ {
+				s.alphabet[c] = s.alphabet[c-'A'+'a']
+			}
+		}
+	}
+	if len(s.base) != len(s.check) {
+		return nil, ErrBadStructure
+	}
+	// give each terminal a slot of its own
+	var terminals []int
+	for i, parent := range s.check {
+		if i != 0 && parent >= 0 && parent < len(s.base) && s.base[parent] == i {
+			terminals = append(terminals, i)
+		}
+	}
+	if modes != nil {
+		s.modes = make([]MatchMode, 1, len(terminals)+1)
+	}
+	for k, i := range terminals {
+		if s.modes != nil {
+			if old := s.base[i]; old < 0 || old >= len(modes) {
+				return nil, ErrBadStructure
+			}
+			s.modes = append(s.modes, MatchMode(modes[s.base[i]]))
+		}
+		s.base[i] = k + 1
+	}
+	s.values = make([]interface{}, len(terminals)+1)
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	s.lazy = &lazyValues{
+		loader: loader,
+		states: make([]int, len(s.values)),
+		once:   make([]sync.Once, len(s.values)),
+	}
+	for _, i := range terminals {
+		s.lazy.states[s.base[i]] = s.check[i]
+	}
+	s.deriveLengths()
+	return s, nil
+}
+
+// lazyValues loads the values of a searcher read by ReadStructure on their
+// first access.
+type lazyValues struct {
+	loader func(word string) interface{}
+	states []int // terminal state by value index
+	once   []sync.Once
+}
+
+func (l *lazyValues) load(s *Searcher, index int) {
+	if index == 0 {
+		return // not used
+	}
+	l.once[index].Do(func() {
+		word := s.path(l.states[index])
+		if s.reversed {
+			word = []byte(reverseString(string(word)))
+		}
+		s.values[index] = l.loader(string(word))
+	})
+}
@@ -0,0 +1,111 @@
+package ahocorasick
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestReadStructure(t *testing.T) {
+	for _, builder := range []*Builder{NewBuilder(), NewBuilder().RemapAlphabet()} {
+		words := []string{"床前", "月光", "明月", "地上", "霜", "是"}
+		for _, word := range words {
+			builder.Add(word, word)
+		}
+		builder.AddWithMode("bad", "bad", WholeWord)
+		searcher := builder.Build()
+		searcher.Compact()
+
+		var buf bytes.Buffer
+		if err := searcher.WriteStructure(&buf); err != nil {
+			t.Fatal(err)
+		}
+		loaded := 0
+		restored, err := ReadStructure(&buf, func(word string) interface{} {
+			loaded++
+			return len(word)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded != 0 {
+			t.Errorf("Unexpected %v words loaded before any access", loaded)
+		}
+		for _, word := range append(words, "bad") {
+			if ok, value := restored.Search(word); !ok || value != len(word) {
+				t.Errorf("Unexpected value %v for '%v'", value, word)
+			}
+		}
+		if ret := restored.Cover("床前明月光x，a疑是地上霜 badly"); len(ret) != len(words) {
+			t.Error("Fail to cover enough words:", ret)
+		}
+		if loaded != len(words)+1 {
+			t.Errorf("Unexpected %v words loaded", loaded)
+		}
+	}
+
+	if _, err := ReadStructure(bytes.NewReader([]byte("ACS0")), nil); !errors.Is(err, ErrBadStructure) {
+		t.Error("Expect ErrBadStructure, got", err)
+	}
+
+	// a forged length must not be allocated ahead of the data
+	var forged bytes.Buffer
+	forged.WriteString(structureMagic)
+	forged.WriteByte(0)
+	binary.Write(&forged, binary.LittleEndian, int64(1)<<38)
+	if _, err := ReadStructure(&forged, nil); !errors.Is(err, ErrBadStructure) {
+		t.Error("Expect ErrBadStructure, got", err)
+	}
+
+	// a childless state with a negative base must fail like Validate
+	forged.Reset()
+	forged.WriteString(structureMagic)
+	forged.WriteByte(0)
+	for _, array := range [][]int64{{0, -10}, {-1, 0}, {0, 0}} {
+		binary.Write(&forged, binary.LittleEndian, int64(len(array)))
+		binary.Write(&forged, binary.LittleEndian, array)
+	}
+	binary.Write(&forged, binary.LittleEndian, int64(0))
+	if _, err := ReadStructure(&forged, func(string) interface{} { return nil }); err == nil {
+		t.Error("Expect an error for a negative base")
+	}
+}
+
+func TestReadStructureLazy(t *testing.T) {
+	builder := NewBuilder()
+	for _, word := range []string{"床前", "月光", "明月", "地上", "霜", "是"} {
+		builder.Add(word, word)
+	}
+	var buf bytes.Buffer
+	if err := builder.Build().WriteStructure(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	loaded := make(map[string]int)
+	restored, err := ReadStructure(&buf, func(word string) interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		loaded[word]++
+		return word
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, value := restored.Search("明月"); !ok || value != "明月" {
+				t.Errorf("Unexpected value %v for '明月'", value)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(loaded) != 1 || loaded["明月"] != 1 {
+		t.Error("Expect only '明月' to be loaded once:", loaded)
+	}
+}
@@ -0,0 +1,288 @@
+package ahocorasick
+
+import (
+	"sort"
+)
+
+// Walk visits every state of the trie in depth-first, byte-wise order,
+// starting from root with an empty path. The path is the bytes from root to
+// the state and is reused between visits. Returning false from `visit` skips
+// the children of the state.
+func (s *Searcher) Walk(visit func(state int, path []byte, terminal bool, value interface{}) bool) {
+	s.walk(0, nil, visit)
+}
+
+func (s *Searcher) walk(state int, path []byte, visit func(state int, path []byte, terminal bool, value interface{}) bool) {
+	var value interface{}
+	index, terminal := s.isTerminal(state)
+	if terminal {
+		value = s.value(index)
+	}
+	if !visit(state, path, terminal, value) {
+		return
+	}
+	for l := 1; l < 256; l++ {
+		if nextState, ok := s.childLabel(state, byte(l)); ok {
+			s.walk(nextState, append(path, s.unlabel(byte(l))), visit)
+		}
+	}
+}
+
+// CompletePage returns the values of up to `limit` words starting with
+// `prefix`, skipping the first `cursor` of them in Walk order, and the
+// cursor of the following page, or 0 if there are no more words.
+func (s *Searcher) CompletePage(prefix string, cursor, limit int) (values []interface{}, nextCursor int) {
+	values = make([]interface{}, 0)
+	state, ok := s.prefixSearch(s.prepare(prefix))
+	if !ok || limit <= 0 {
+		return values, 0
+	}
+	index := 0
+	more := false
+	s.walk(state, nil, func(state int, path []byte, terminal bool, value interface{}) bool {
+		if more {
+			return false
+		}
+		if terminal {
+			if index >= cursor {
+				if len(values) == limit {
+					more = true
+					return false
+				}
+				values = append(values, value)
+			}
+			index++
+		}
+		return true
+	})
+	if more {
+		nextCursor = cursor + len(values)
+	}
+	return values, nextCursor
+}
+
+// NearestWithin returns the value of the word closest to `query` by
+// Levenshtein distance over bytes, if within `k`, and the distance. Among
+// words at the same distance, the first in Walk order wins. The trie is
+// searched depth-first keeping one row of the distance table per depth and
+// pruning branches whose row exceeds the best so far, which is practical for
+// small `k`. Like Search, it takes a reversed query for a searcher built with
+// ReverseMatch.
+func (s *Searcher) NearestWithin(query string, k int) (value interface{}, distance int, ok bool) {
+	query = s.prepare(query)
+	if s.folded {
+		// the labels unlabel to the lower case bytes
+		query = foldASCII(query)
+	}
+	best := k + 1
+	row := make([]int, len(query)+1)
+	for j := range row {
+		row[j] = j
+	}
+	var search func(state int, prev []int)
+	search = func(state int, prev []int) {
+		if index, terminal := s.isTerminal(state); terminal && prev[len(query)] < best {
+			value, distance, ok = s.value(index), prev[len(query)], true
+			best = distance
+		}
+		for l := 1; l < 256; l++ {
+			nextState, found := s.childLabel(state, byte(l))
+			if !found {
+				continue
+			}
+			c := s.unlabel(byte(l))
+			cur := make([]int, len(prev))
+			cur[0] = prev[0] + 1
+			lowest := cur[0]
+			for j := 1; j < len(cur); j++ {
+				cost := 1
+				if query[j-1] == c {
+					cost = 0
+				}
+				cur[j] = min(cur[j-1]+1, prev[j]+1, prev[j-1]+cost)
+				lowest = min(lowest, cur[j])
+			}
+			if lowest < best {
+				search(nextState, cur)
+			}
+		}
+	}
+	search(0, row)
+	return value, distance, ok
+}
+
+// DumpOrder tells how Dump orders the words.
+type DumpOrder int
+
+const (
+	// ByTrie orders the words byte-wise, as visited by Walk.
+	ByTrie DumpOrder = iota
+	// ByInsertion orders the words as they were added to the builder.
+	ByInsertion
+)
+
+// Entry is a word of the dictionary with its value.
+type Entry struct {
+	Word  string
+	Value interface{}
+}
+
+// Dump returns the words of the dictionary in the given `order`. Words are
+// as stored, i.e. normalized for a searcher built with Normalize, and
+// duplicates only appear once. A searcher made by NewSearcherFromArrays
+// doesn't know the insertion order and always dumps ByTrie.
+func (s *Searcher) Dump(order DumpOrder) []Entry {
+	ret := make([]Entry, 0)
+	s.Walk(func(state int, path []byte, terminal bool, value interface{}) bool {
+		if terminal {
+			word := string(path)
+			if s.reversed {
+				word = reverseString(word)
+			}
+			ret = append(ret, Entry{word, value})
+		}
+		return true
+	})
+	if order == ByInsertion && len(s.order) == len(ret) {
+		ranks := make([]int, len(ret))
+		copy(ranks, s.order)
+		sort.Sort(&entrySorter{ret, ranks})
+	}
+	return ret
+}
+
+type entrySorter struct {
+	entries []Entry
+	ranks   []int
+}
+
+func (es *entrySorter) Len() int {
+	return len(es.entries)
+}
+
+func (es *entrySorter) Less(i, j int) bool {
+	return es.ranks[i] < es.ranks[j]
+}
+
+func (es *entrySorter) Swap(i, j int) {
+	es.entries[i], es.entries[j] = es.entries[j], es.entries[i]
+	es.ranks[i], es.ranks[j] = es.ranks[j], es.ranks[i]
+}
+
+// Filter builds a new searcher from the words of this one accepted by
+// `keep`, which sees them as Dump returns them. The options and attributes
+// of the words, like WholeWord modes, weights, tags and byte values, are
+// kept, and so is the insertion order.
+func (s *Searcher) Filter(keep func(word string, value interface{}) bool) *Searcher {
+	b := NewBuilder()
+	if s.alphabet != nil {
+		b.RemapAlphabet()
+	}
+	if s.escapeNull {
+		b.EscapeNull()
+	}
+	if s.folded {
+		b.CaseInsensitive()
+	}
+	if s.reversed {
+		b.ReverseMatch()
+	}
+	if s.bloom != nil {
+		b.WithBloom()
+	}
+	tagNames := make([]string, len(s.tagIDs))
+	for tag, id := range s.tagIDs {
+		tagNames[id] = tag
+	}
+
+	type kept struct {
+		word        string
+		value       interface{}
+		index, rank int
+	}
+	var words []kept
+	k := 0 // terminals visited, i.e. the rank in trie order
+	s.Walk(func(state int, path []byte, terminal bool, value interface{}) bool {
+		if !terminal {
+			return true
+		}
+		word := string(path)
+		if s.reversed {
+			word = reverseString(word)
+		}
+		if keep(word, value) {
+			rank := k
+			if k < len(s.order) {
+				rank = s.order[k]
+			}
+			words = append(words, kept{word, value, s.valueIndex(state), rank})
+		}
+		k++
+		return true
+	})
+	sort.Slice(words, func(i, j int) bool { return words[i].rank < words[j].rank })
+
+	for _, w := range words {
+		mode := Substring
+		if s.modes != nil {
+			mode = s.modes[w.index]
+		}
+		b.AddWithMode(w.word, w.value, mode)
+		if s.weights != nil {
+			b.wordWeights[len(b.wordWeights)-1] = s.weights[w.index]
+			b.weighted = true
+		}
+		if s.tags != nil {
+			var tags []string
+			for _, id := range s.tagSets[s.tags[w.index]] {
+				tags = append(tags, tagNames[id])
+			}
+			b.tagLast(tags)
+		}
+		if s.byteValues != nil && s.byteValues[w.index] != nil {
+			b.wordByteValues[len(b.wordByteValues)-1] = s.byteValues[w.index]
+			b.hasBytes = true
+		}
+	}
+	ret := b.Build()
+	// the words are normalized already
+	ret.normalize = s.normalize
+	return ret
+}
+
+// unlabel returns the byte stored as label `l` in the trie.
+func (s *Searcher) unlabel(l byte) byte {
+	if s.labels == nil {
+		return l
+	}
+	return s.labels[l]
+}
+
+// Parent returns the state `state` is a child of, from `check`, and the byte
+// of the transition, which is '\0' for the slot marking a terminal state, or
+// false for root and unused states.
+func (s *Searcher) Parent(state int) (parent int, viaByte byte, ok bool) {
+	if state <= 0 || state >= len(s.check) || s.check[state] < 0 {
+		return 0, 0, false
+	}
+	parent = s.check[state]
+	l := state - s.base[parent]
+	if l == 0 {
+		return parent, 0, true
+	}
+	return parent, s.unlabel(byte(l)), true
+}
+
+// path returns the bytes from root to `state` by climbing Parent.
+func (s *Searcher) path(state int) []byte {
+	var ret []byte
+	for state != 0 {
+		parent, c, _ := s.Parent(state)
+		ret = append(ret, c)
+		state = parent
+	}
+	for i, j := 0, len(ret)-1; i < j; i, j = i+1, j-1 {
+		ret[i], ret[j] = ret[j], ret[i]
+	}
+	return ret
+}
@@ -0,0 +1,222 @@
+package ahocorasick
+
+import (
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	for _, remap := range []bool{false, true} {
+		builder := NewBuilder()
+		if remap {
+			builder.RemapAlphabet()
+		}
+		words := []string{"he", "hers", "his", "she"}
+		for _, word := range words {
+			builder.Add(word, word)
+		}
+		searcher := builder.Build()
+
+		var terminals []string
+		states := 0
+		searcher.Walk(func(state int, path []byte, terminal bool, value interface{}) bool {
+			states++
+			if terminal {
+				terminals = append(terminals, string(path))
+				if value != string(path) {
+					t.Errorf("Unexpected value %v for '%s'", value, path)
+				}
+			}
+			return true
+		})
+		if len(terminals) != len(words) {
+			t.Fatal("Unexpected terminals:", terminals)
+		}
+		for i, word := range words {
+			if terminals[i] != word {
+				t.Errorf("Unexpected terminal '%v', want '%v'", terminals[i], word)
+			}
+		}
+		if states != searcher.Stats().States {
+			t.Errorf("Unexpected visited states %v", states)
+		}
+
+		// prune the subtree of 'h'
+		terminals = nil
+		searcher.Walk(func(state int, path []byte, terminal bool, value interface{}) bool {
+			if terminal {
+				terminals = append(terminals, string(path))
+			}
+			return string(path) != "h"
+		})
+		if len(terminals) != 1 || terminals[0] != "she" {
+			t.Error("Unexpected terminals after pruning:", terminals)
+		}
+	}
+}
+
+func TestCompletePage(t *testing.T) {
+	searcher := NewBuilder().Add("ca", "ca").Add("car", "car").Add("card", "card").Add("care", "care").Add("dog", "dog").Build()
+	var pages [][]interface{}
+	cursor := 0
+	for {
+		values, next := searcher.CompletePage("ca", cursor, 2)
+		pages = append(pages, values)
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	if len(pages) != 2 || len(pages[0]) != 2 || len(pages[1]) != 2 {
+		t.Fatal("Unexpected pages:", pages)
+	}
+	for i, word := range []string{"ca", "car", "card", "care"} {
+		if pages[i/2][i%2] != word {
+			t.Errorf("Unexpected completion %v, want '%v'", pages[i/2][i%2], word)
+		}
+	}
+	if values, next := searcher.CompletePage("car", 0, 3); len(values) != 3 || next != 0 {
+		t.Error("Unexpected last page:", values, next)
+	}
+	if values, next := searcher.CompletePage("x", 0, 2); len(values) != 0 || next != 0 {
+		t.Error("Unexpected completions:", values, next)
+	}
+}
+
+func TestNearestWithin(t *testing.T) {
+	searcher := NewBuilder().Add("hello", "hello").Add("world", "world").Add("help", "help").Build()
+	if value, distance, ok := searcher.NearestWithin("helo", 1); !ok || value != "hello" || distance != 1 {
+		t.Errorf("Unexpected nearest %v at %v for 'helo'", value, distance)
+	}
+	if value, distance, ok := searcher.NearestWithin("world", 2); !ok || value != "world" || distance != 0 {
+		t.Errorf("Unexpected nearest %v at %v for 'world'", value, distance)
+	}
+	if value, distance, ok := searcher.NearestWithin("wrd", 2); !ok || value != "world" || distance != 2 {
+		t.Errorf("Unexpected nearest %v at %v for 'wrd'", value, distance)
+	}
+	if _, _, ok := searcher.NearestWithin("xyz", 1); ok {
+		t.Error("Unexpected word within 1 of 'xyz'")
+	}
+
+	searcher = NewBuilder().CaseInsensitive().Add("hello", "hello").Build()
+	if value, distance, ok := searcher.NearestWithin("HELLO", 1); !ok || value != "hello" || distance != 0 {
+		t.Errorf("Unexpected nearest %v at %v for 'HELLO'", value, distance)
+	}
+	if value, distance, ok := searcher.NearestWithin("HeLo", 1); !ok || value != "hello" || distance != 1 {
+		t.Errorf("Unexpected nearest %v at %v for 'HeLo'", value, distance)
+	}
+
+	// the query is reversed by the caller, like for Search
+	searcher = NewBuilder().ReverseMatch().Add("hello", "hello").Build()
+	if value, distance, ok := searcher.NearestWithin("oleh", 1); !ok || value != "hello" || distance != 1 {
+		t.Errorf("Unexpected nearest %v at %v for 'oleh'", value, distance)
+	}
+	if _, _, ok := searcher.NearestWithin("hello", 1); ok {
+		t.Error("Unexpected match of 'hello' unreversed")
+	}
+}
+
+func TestDump(t *testing.T) {
+	words := []string{"she", "his", "hers", "he"}
+	builder := NewBuilder()
+	for _, word := range words {
+		builder.AddWord(word)
+	}
+	builder.Add("his", -1) // duplicate
+	searcher := builder.Build()
+
+	ret := searcher.Dump(ByInsertion)
+	if len(ret) != len(words) {
+		t.Fatal("Unexpected entries:", ret)
+	}
+	for i, word := range words {
+		if ret[i].Word != word || ret[i].Value != i {
+			t.Errorf("Unexpected entry %v, want '%v'", ret[i], word)
+		}
+	}
+
+	ret = searcher.Dump(ByTrie)
+	for i, word := range []string{"he", "hers", "his", "she"} {
+		if ret[i].Word != word {
+			t.Errorf("Unexpected entry %v, want '%v'", ret[i], word)
+		}
+	}
+
+	searcher = NewBuilder().ReverseMatch().Add("abc", 1).Build()
+	if ret := searcher.Dump(ByInsertion); len(ret) != 1 || ret[0].Word != "abc" {
+		t.Error("Unexpected entries of a reversed searcher:", ret)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	builder := NewBuilder().
+		AddWeighted("severe", "severe", 5).
+		AddWeighted("mild", "mild", 1).
+		AddTagged("awful", "awful", "pii").
+		AddWithMode("bad", "bad", WholeWord).
+		Add("ugly", "ugly")
+	searcher := builder.Build()
+	filtered := searcher.Filter(func(word string, value interface{}) bool {
+		return word == "severe" || word == "awful" || word == "bad"
+	})
+	text := "severe mild awful badly ugly bad"
+	ret := filtered.Cover(text)
+	if len(ret) != 3 || ret[0] != "severe" || ret[1] != "awful" || ret[2] != "bad" {
+		t.Error("Unexpected matches of the filtered searcher:", ret)
+	}
+	if score := filtered.CoverScore(text); score != 5 {
+		t.Errorf("Unexpected score %v", score)
+	}
+	if ret := filtered.CoverByTag(text, "pii"); len(ret) != 1 || ret[0] != "awful" {
+		t.Error("Unexpected pii matches:", ret)
+	}
+	if ret := filtered.Cover("badly"); len(ret) != 0 {
+		t.Error("Unexpected WholeWord match:", ret)
+	}
+	dump := filtered.Dump(ByInsertion)
+	if len(dump) != 3 || dump[0].Word != "severe" || dump[1].Word != "awful" || dump[2].Word != "bad" {
+		t.Error("Unexpected insertion order:", dump)
+	}
+
+	searcher = NewBuilder().EscapeNull().Add("a\x00b", 1).Add("\x00", 2).Add("ab", 3).Build()
+	filtered = searcher.Filter(func(word string, value interface{}) bool {
+		return word != "ab"
+	})
+	if ok, value := filtered.Search("a\x00b"); !ok || value != 1 {
+		t.Errorf("Unexpected value %v for 'a\\0b'", value)
+	}
+	if filtered.Contains("ab") {
+		t.Error("Unexpected word dropped by the filter")
+	}
+}
+
+func TestParent(t *testing.T) {
+	for _, remap := range []bool{false, true} {
+		builder := NewBuilder()
+		if remap {
+			builder.RemapAlphabet()
+		}
+		searcher := builder.Add("hello", 1).Add("help", 2).Build()
+		state, ok := searcher.prefixSearch("hello")
+		if !ok {
+			t.Fatal("Fail to walk 'hello'")
+		}
+		var spelled []byte
+		for state = searcher.base[state]; state != 0; {
+			parent, c, ok := searcher.Parent(state)
+			if !ok {
+				t.Fatalf("No parent for state %v", state)
+			}
+			spelled = append([]byte{c}, spelled...)
+			state = parent
+		}
+		if string(spelled) != "hello\x00" {
+			t.Errorf("Unexpected spelling %q", spelled)
+		}
+		if _, _, ok := searcher.Parent(0); ok {
+			t.Error("Unexpected parent of root")
+		}
+		if _, _, ok := searcher.Parent(len(searcher.check)); ok {
+			t.Error("Unexpected parent out of range")
+		}
+	}
+}